@@ -0,0 +1,121 @@
+// Command backtest replays historical prices from a CSV or Binance kline JSON
+// file through the alert rules and reports when each alert would have fired.
+//
+//	go run ./cmd/backtest -data btc-1m.csv -symbol BTCUSDT -threshold 65000,70000
+//	go run ./cmd/backtest -data klines.json -symbol BTCUSDT -db alerts.db
+//
+// Like the live engine, every crossing fires. -cooldown shows how many of
+// them a cooldown would have suppressed; it is off by default.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Secretstar513/crypto-alerts/internal/backtest"
+	"github.com/Secretstar513/crypto-alerts/internal/db"
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+)
+
+func main() {
+	data := flag.String("data", "", "CSV (time,price or Binance kline columns) or Binance kline .json file")
+	symbol := flag.String("symbol", "", "symbol the data belongs to, e.g. BTCUSDT")
+	thresholds := flag.String("threshold", "", "comma-separated thresholds to test")
+	direction := flag.String("direction", "BOTH", "UP, DOWN or BOTH")
+	dbPath := flag.String("db", "", "test the symbol's enabled alerts from this SQLite DB instead of -threshold")
+	cooldown := flag.Duration("cooldown", 0, "count crossings within this long after a fire as suppressed; the live engine has no cooldown")
+	verbose := flag.Bool("v", false, "list every fire")
+	flag.Parse()
+
+	if *data == "" || *symbol == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	sym := strings.ToUpper(*symbol)
+
+	alerts, err := loadAlerts(sym, *thresholds, strings.ToUpper(*direction), *dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(alerts) == 0 {
+		log.Fatalf("no alerts to test for %s; pass -threshold or -db", sym)
+	}
+
+	ticks, err := backtest.LoadFile(*data)
+	if err != nil {
+		log.Fatalf("load %s: %v", *data, err)
+	}
+	if len(ticks) == 0 {
+		log.Fatalf("%s: no prices", *data)
+	}
+	fmt.Printf("%s: %d prices from %s to %s\n\n", sym, len(ticks),
+		ticks[0].Time.Format(time.RFC3339), ticks[len(ticks)-1].Time.Format(time.RFC3339))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTION\tTHRESHOLD\tFIRES\tSUPPRESSED\tFIRST\tLAST")
+	for _, r := range backtest.Run(ticks, alerts, *cooldown) {
+		first, last := "-", "-"
+		if n := len(r.Fires); n > 0 {
+			first = r.Fires[0].Time.Format(time.RFC3339)
+			last = r.Fires[n-1].Time.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%.8g\t%d\t%d\t%s\t%s\n", r.Alert.Direction, r.Alert.Threshold, len(r.Fires), r.Suppressed, first, last)
+		if *verbose {
+			for _, f := range r.Fires {
+				fmt.Fprintf(tw, "\t\t\t\t%s\t@ %.8g\n", f.Time.Format(time.RFC3339), f.Price)
+			}
+		}
+	}
+	tw.Flush()
+}
+
+func loadAlerts(symbol, thresholds, direction, dbPath string) ([]domain.Alert, error) {
+	if dbPath != "" {
+		var list []domain.Alert
+		err := db.OpenSQLite(dbPath).Where("symbol = ? AND enabled = ?", symbol, true).Order("threshold asc").Find(&list).Error
+		// Compound conditions, ratios, spreads and arbitrage alerts depend on
+		// other symbols or exchanges, which a single-symbol replay doesn't have.
+		out := list[:0]
+		for _, al := range list {
+			if al.Kind == domain.KindPrice && al.Expr == "" {
+				out = append(out, al)
+			}
+		}
+		return out, err
+	}
+	var dirs []domain.Direction
+	switch direction {
+	case "UP":
+		dirs = []domain.Direction{domain.DirectionUp}
+	case "DOWN":
+		dirs = []domain.Direction{domain.DirectionDown}
+	case "BOTH":
+		dirs = []domain.Direction{domain.DirectionUp, domain.DirectionDown}
+	default:
+		return nil, fmt.Errorf("direction must be UP, DOWN or BOTH")
+	}
+	var out []domain.Alert
+	for _, s := range strings.Split(thresholds, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		thr, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("threshold %q: %w", s, err)
+		}
+		for _, d := range dirs {
+			al := domain.Alert{Kind: domain.KindPrice, Symbol: symbol, Threshold: thr, Direction: d, Severity: domain.SeverityInfo}
+			if err := domain.ValidateAlert(&al); err != nil {
+				return nil, err
+			}
+			out = append(out, al)
+		}
+	}
+	return out, nil
+}
@@ -2,27 +2,69 @@ package main
 
 import (
 	"context"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
+	_ "time/tzdata" // channel schedules need IANA zones even on minimal images
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/Secretstar513/crypto-alerts/internal/app"
+	"github.com/Secretstar513/crypto-alerts/internal/bot"
 	"github.com/Secretstar513/crypto-alerts/internal/config"
 	"github.com/Secretstar513/crypto-alerts/internal/server"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram"
 )
 
 func main() {
-	cfg := config.Load()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file; environment variables override it")
+	printConfig := flag.Bool("print-config", false, "print the effective config, secrets redacted, and exit")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("load config")
+	}
+	if *printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			log.Fatal().Err(err).Msg("print config")
+		}
+		os.Stdout.Write(out)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid config")
+	}
+	if *printConfig {
+		return
+	}
 	a := app.New(cfg)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	a.Start(ctx)
 
+	if cfg.TelegramCommands {
+		// The bot is built once, so channel changes made in the UI reach it
+		// on the next restart.
+		tc, err := a.TelegramConfig()
+		if err != nil {
+			log.Fatal().Err(err).Msg("telegram commands")
+		}
+		if tc.BotToken != "" && tc.ChatID != "" {
+			b, err := bot.New(a, telegram.NewClient(tc.APIURL, tc.BotToken), tc.ChatID)
+			if err != nil {
+				log.Fatal().Err(err).Msg("telegram commands")
+			}
+			a.Go(func() { b.Run(ctx) })
+			log.Info().Msg("telegram commands enabled")
+		} else {
+			log.Warn().Msg("telegram commands need a bot token and chat ID")
+		}
+	}
+
 	h := server.NewHandlers(a)
 	srv := &http.Server{
 		Addr:    cfg.Addr,
@@ -40,7 +82,15 @@ func main() {
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 	<-ch
 	log.Info().Msg("shutting down...")
-	_ = srv.Shutdown(context.Background())
-	a.Stop()
-	time.Sleep(300 * time.Millisecond)
+	// One deadline covers both the HTTP server and the engine.
+	sctx, scancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer scancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		log.Error().Err(err).Msg("http shutdown")
+	}
+	cancel()
+	if err := a.Shutdown(sctx); err != nil {
+		log.Error().Err(err).Msg("engine shutdown")
+	}
+	log.Info().Msg("stopped")
 }
@@ -4,93 +4,261 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nuid"
-	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 
 	"github.com/Secretstar513/crypto-alerts/internal/config"
 	"github.com/Secretstar513/crypto-alerts/internal/db"
 	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/history"
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
 	"github.com/Secretstar513/crypto-alerts/internal/notif"
 	"github.com/Secretstar513/crypto-alerts/internal/price"
 	"github.com/Secretstar513/crypto-alerts/internal/rules"
+	"github.com/Secretstar513/crypto-alerts/internal/secrets"
+)
+
+var (
+	ErrAlertNotFound  = errors.New("alert not found")
+	ErrUnknownChannel = errors.New("unknown channel")
+	// ErrChannelDisabled is returned when testing a disabled channel.
+	ErrChannelDisabled = errors.New("channel is disabled")
 )
 
 type App struct {
-	Cfg        *config.Config
-	DB         *gorm.DB
-	Router     *price.Router
-	Notifiers  []notif.Notifier
-	cancel     context.CancelFunc
+	Cfg *config.Config
+	DB  *gorm.DB
+	// Router streams Binance, or the replay standing in for it; routers
+	// holds the other exchanges' routers by name.
+	Router    *price.Router
+	routers   map[string]*price.Router
+	binance   *price.BinanceFeed
+	History   *history.Store
+	Notifiers []notif.Notifier
+	cancel    context.CancelFunc
+	// workers tracks the goroutines Start launches so Stop can drain them.
+	workers sync.WaitGroup
+	// sendCtx carries notifications. It outlives Start's context so that
+	// sends in flight at shutdown can finish, until Stop's deadline cancels it.
+	sendCtx    context.Context
+	sendCancel context.CancelFunc
+	recorder   *price.Recorder
+	stopOnce   sync.Once
+	stopErr    error
+	mu         sync.RWMutex
+	// channels maps a notifier name to its channel row, for routing.
+	channels  map[string]domain.Channel
+	summaries *summaryBook
+	pairs     *pairBook
+	studies   *studyBook
+	exprs     *exprBook
+	// keys encrypts channel configs; nil stores them in plaintext.
+	keys *secrets.Keyring
+	// engineBeat is the unix nano time of the engine loop's last pass.
+	engineBeat atomic.Int64
+	// now stamps fired alerts and drives the notification schedules.
+	now func() time.Time
 }
 
 func New(cfg *config.Config) *App {
 	d := db.OpenSQLite(cfg.DBPath)
 
-	if err := d.AutoMigrate(&domain.Alert{}, &domain.Channel{}, &domain.LastPrice{}); err != nil {
+	if err := migrateLastPrices(d); err != nil {
+		panic(err)
+	}
+	if err := d.AutoMigrate(&domain.Alert{}, &domain.Channel{}, &domain.LastPrice{}, &domain.PendingEvent{}, &domain.Candle{}); err != nil {
+		panic(err)
+	}
+	// Alerts saved before conditions existed got a NULL expr, which the
+	// engine's expr = '' filter wouldn't match.
+	if err := d.Exec("UPDATE alerts SET expr = '' WHERE expr IS NULL").Error; err != nil {
 		panic(err)
 	}
 
-	notifs := []notif.Notifier{
-		notif.NewLog(true),
-		notif.NewEmail(notif.EmailConfig{
-			Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Pass: cfg.SMTPPass,
-			From: cfg.EmailFrom, To: cfg.EmailTo,
-		}, true),
-		notif.NewTelegram(cfg.TelegramBotToken, cfg.TelegramChatID, true),
+	a := &App{
+		Cfg:     cfg,
+		DB:      d,
+		pairs:   newPairBook(),
+		studies: newStudyBook(),
+		exprs:   newExprBook(),
+		now:     time.Now,
+		binance: &price.BinanceFeed{
+			WSURL:         cfg.BinanceWSURL,
+			RESTURL:       cfg.BinanceRESTURL,
+			PollInterval:  cfg.PollInterval,
+			RetryDelay:    cfg.ReconnectDelay,
+			MaxRetryDelay: cfg.ReconnectMaxDelay,
+			HTTP:          http.DefaultClient,
+		},
+		History:   history.NewStore(d, cfg.CandleRetention),
+		summaries: newSummaryBook(),
+	}
+	a.sendCtx, a.sendCancel = context.WithCancel(context.Background())
+	a.Router = price.NewRouter(price.ExchangeBinance, a.newFeed())
+	a.routers = secondaryRouters(cfg)
+	keys, err := cfg.Keyring()
+	if err != nil {
+		panic(err)
+	}
+	a.keys = keys
+	if err := a.sealChannels(); err != nil {
+		panic(err)
+	}
+	if err := a.seedChannels(); err != nil {
+		panic(err)
+	}
+	if err := a.Reload(); err != nil {
+		panic(err)
 	}
+	return a
+}
 
-	return &App{
-		Cfg:       cfg,
-		DB:        d,
-		Router:    price.NewRouter(),
-		Notifiers: notifs,
+// newFeed picks the price source: a recording when PriceReplayFile is set,
+// otherwise Binance, optionally teed to PriceRecordFile.
+func (a *App) newFeed() price.Feed {
+	cfg := a.Cfg
+	if cfg.PriceReplayFile != "" {
+		rp, err := price.NewReplayer(cfg.PriceReplayFile, cfg.PriceReplaySpeed)
+		if err != nil {
+			panic(err)
+		}
+		return rp
 	}
+	var feed price.Feed = a.binance
+	if cfg.PriceRecordFile != "" {
+		rec, err := price.NewRecorder(feed, cfg.PriceRecordFile)
+		if err != nil {
+			panic(err)
+		}
+		a.recorder = rec
+		feed = rec
+	}
+	return feed
 }
 
 func (a *App) Start(ctx context.Context) {
 	ctx, a.cancel = context.WithCancel(ctx)
-	go a.runEngine(ctx)
+	a.spawn(func() { a.runEngine(ctx) })
+	a.spawn(func() { a.runScheduler(ctx) })
+	a.spawn(func() { a.runWatchdog(ctx) })
+	a.spawn(func() { a.History.Run(ctx, 10*time.Second) })
+}
+
+func (a *App) spawn(f func()) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		f()
+	}()
+}
+
+// Go runs f alongside the engine's workers, so Stop waits for it too. f must
+// return once the context passed to Start is cancelled.
+func (a *App) Go(f func()) {
+	a.spawn(f)
 }
 
-func (a *App) Stop() {
+// Stop is Shutdown with Cfg.ShutdownTimeout as the deadline.
+func (a *App) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.Cfg.ShutdownTimeout)
+	defer cancel()
+	return a.Shutdown(ctx)
+}
+
+// Shutdown stops the price feeds and workers, letting them finish the updates
+// already buffered and the notifications already being sent. Sends still in
+// flight when ctx is done are cancelled. Buffered candles are then flushed
+// and the database closed. Only the first call to Shutdown or Stop has any
+// effect.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.stopOnce.Do(func() { a.stopErr = a.stop(ctx) })
+	return a.stopErr
+}
+
+func (a *App) stop(ctx context.Context) error {
 	if a.cancel != nil {
 		a.cancel()
 	}
 	a.Router.StopAll()
+	for _, r := range a.routers {
+		r.StopAll()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+	var errs []error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Return at the deadline: the sends still in flight are cancelled
+		// below and left to unwind on their own.
+		errs = append(errs, errors.New("drain deadline exceeded: in-flight notifications cancelled"))
+	}
+	a.sendCancel()
+
+	if err := a.History.Flush(); err != nil {
+		errs = append(errs, fmt.Errorf("flush candles: %w", err))
+	}
+	if a.recorder != nil {
+		if err := a.recorder.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close recording: %w", err))
+		}
+	}
+	if sqlDB, err := a.DB.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close database: %w", err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (a *App) runEngine(ctx context.Context) {
-	tk := time.NewTicker(5 * time.Second)
+	tk := time.NewTicker(a.Cfg.EngineTick)
 	defer tk.Stop()
 
 	type subInfo struct {
 		sub price.Subscriber
 	}
-	subs := map[string]subInfo{} 
+	subs := map[feedKey]subInfo{}
 
 	for {
+		a.engineBeat.Store(time.Now().UnixNano())
 		var alerts []domain.Alert
 		if err := a.DB.Where("enabled = ?", true).Find(&alerts).Error; err == nil {
-			need := map[string]struct{}{}
+			need := map[feedKey]struct{}{}
 			for _, al := range alerts {
-				need[al.Symbol] = struct{}{}
+				for _, k := range a.alertFeeds(al) {
+					need[k] = struct{}{}
+				}
 			}
-			for sym := range need {
-				if _, ok := subs[sym]; !ok {
-					subs[sym] = subInfo{sub: a.Router.Subscribe(ctx, sym)}
+			for k := range need {
+				if _, ok := subs[k]; ok {
+					continue
+				}
+				if r := a.router(k.exchange); r != nil {
+					subs[k] = subInfo{sub: r.Subscribe(ctx, k.symbol)}
 				}
 			}
 		}
 
-		for sym, si := range subs {
-			select {
-			case upd := <-si.sub:
-				a.handlePriceUpdate(ctx, upd.Symbol, upd.Price)
-			default:
-				_ = sym
+		for k, si := range subs {
+		drain:
+			for {
+				select {
+				case upd := <-si.sub:
+					a.handlePriceUpdate(ctx, k.exchange, upd)
+				default:
+					break drain
+				}
 			}
 		}
 
@@ -102,83 +270,253 @@ func (a *App) runEngine(ctx context.Context) {
 	}
 }
 
-func (a *App) handlePriceUpdate(ctx context.Context, symbol string, priceVal float64) {
+// handlePriceUpdate evaluates the alerts that depend on symbol's price on
+// exchange. Only Binance prices are kept as history and drive price and
+// condition alerts; other exchanges just feed arbitrage alerts.
+func (a *App) handlePriceUpdate(ctx context.Context, exchange string, upd price.Update) {
+	defer func(start time.Time) { metrics.UpdateDuration.Observe(time.Since(start).Seconds()) }(time.Now())
+	symbol, priceVal, at := upd.Symbol, upd.Price, upd.Time
+	var day domain.DayStats
+	if upd.Stats != nil {
+		day = domain.DayStats(*upd.Stats)
+	}
+	if exchange != domain.ExchangeBinance {
+		a.DB.Save(&domain.LastPrice{Exchange: exchange, Symbol: symbol, Price: priceVal, UpdatedAt: time.Now()})
+		a.evaluatePairs(exchange, symbol, priceVal, at)
+		return
+	}
+	a.observe(symbol, priceVal)
+	a.History.Record(symbol, priceVal, at)
+	a.evaluatePairs(exchange, symbol, priceVal, at)
+	a.evaluateIndicators(symbol, priceVal, at)
+
 	var lp domain.LastPrice
-	if err := a.DB.First(&lp, "symbol = ?", symbol).Error; errors.Is(err, gorm.ErrRecordNotFound) {
-		lp = domain.LastPrice{Symbol: symbol, Price: priceVal, UpdatedAt: time.Now()}
+	if err := a.DB.First(&lp, "exchange = ? AND symbol = ?", exchange, symbol).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		lp = domain.LastPrice{Exchange: exchange, Symbol: symbol, Price: priceVal, Day: day, UpdatedAt: time.Now()}
 		a.DB.Save(&lp)
 		return
 	}
+	before := lp
 	prev := lp.Price
 	lp.Price = priceVal
+	lp.Day = day
 	lp.UpdatedAt = time.Now()
 	a.DB.Save(&lp)
+	a.evaluateDaily(before, lp)
 
 	var alerts []domain.Alert
-	if err := a.DB.Where("enabled = ? AND symbol = ?", true, symbol).Find(&alerts).Error; err != nil {
+	if err := a.DB.Preload("Channels").Where("enabled = ? AND kind = ? AND symbol = ? AND expr = ''", true, domain.KindPrice, symbol).Find(&alerts).Error; err != nil {
 		return
 	}
 
+	metrics.RuleEvaluations.WithLabelValues(symbol, string(domain.KindPrice)).Add(float64(len(alerts)))
 	for _, al := range alerts {
 		if rules.Crosses(prev, priceVal, &al) {
-			a.fire(ctx, al, priceVal)
+			metrics.AlertsFired.WithLabelValues(al.Symbol, ruleKind(al), string(al.Severity)).Inc()
+			a.fire(a.sendCtx, al, symbol, priceVal)
 		}
 	}
+	a.evaluateExprs(symbol, prev, priceVal)
 }
 
-func (a *App) fire(ctx context.Context, al domain.Alert, priceVal float64) {
+// evaluateExprs evaluates the enabled condition alerts that reference
+// symbol after its price moved from prev to priceVal. The other symbols of a
+// condition take their last stored prices. An alert fires when its condition
+// becomes true with this update.
+func (a *App) evaluateExprs(symbol string, prev, priceVal float64) {
+	live, err := a.exprs.enabled(func() ([]domain.Alert, error) {
+		var alerts []domain.Alert
+		return alerts, a.DB.Preload("Channels").Where("enabled = ? AND expr <> ''", true).Find(&alerts).Error
+	})
+	if err != nil {
+		return
+	}
+	for _, x := range live {
+		al, e := x.al, x.e
+		if !e.References(symbol) {
+			continue
+		}
+		var lps []domain.LastPrice
+		if err := a.DB.Where("exchange = ? AND symbol IN ?", domain.ExchangeBinance, e.Symbols()).Find(&lps).Error; err != nil {
+			return
+		}
+		cur := make(map[string]float64, len(lps))
+		before := make(map[string]float64, len(lps))
+		for _, lp := range lps {
+			cur[lp.Symbol] = lp.Price
+			before[lp.Symbol] = lp.Price
+		}
+		cur[symbol], before[symbol] = priceVal, prev
+
+		metrics.RuleEvaluations.WithLabelValues(symbol, ruleKind(al)).Inc()
+		if e.Fires(before, cur) {
+			metrics.AlertsFired.WithLabelValues(al.Symbol, ruleKind(al), string(al.Severity)).Inc()
+			a.fire(a.sendCtx, al, symbol, priceVal)
+		}
+	}
+}
+
+// ruleKind labels al's metrics: its kind, or EXPR for a condition. Metrics
+// are labelled by symbol and kind rather than series so that periods,
+// intervals and pairs don't each add a time series.
+func ruleKind(al domain.Alert) string {
+	if al.Expr != "" {
+		return "EXPR"
+	}
+	return string(al.Kind)
+}
+
+// fire notifies al's targets that it fired with symbol, or its derived
+// series, at priceVal.
+func (a *App) fire(ctx context.Context, al domain.Alert, symbol string, priceVal float64) {
 	ev := notif.Event{
-		Symbol: al.Symbol, Price: priceVal, Threshold: al.Threshold, Direction: string(al.Direction),
+		Symbol: symbol, Price: priceVal, Threshold: al.Threshold, Direction: string(al.Direction),
+		Condition: al.Expr, Severity: string(al.Severity), Time: a.now(),
 	}
-	for _, n := range a.Notifiers {
-		if n.Enabled() {
-			if err := n.Notify(ctx, ev); err != nil {
-				log.Error().Err(err).Str("notifier", n.Name()).Msg("notify failed")
-			}
+	for _, t := range a.targets(al) {
+		if t.n.Enabled() {
+			a.deliver(ctx, t, ev)
 		}
 	}
 }
 
-func (a *App) CreateAlert(symbol string, thr float64, dir domain.Direction) (domain.Alert, error) {
-	al := domain.Alert{
-		ID:        nuid.Next(),
-		Symbol:    symbol,
-		Threshold: thr,
-		Direction: dir,
-		Enabled:   true,
+// CreateAlert validates and stores al as a new, enabled alert. Only the IDs of
+// al.Channels are used; unknown channel IDs are rejected.
+func (a *App) CreateAlert(al domain.Alert) (domain.Alert, error) {
+	al.ID = nuid.Next()
+	al.Enabled = true
+	if al.Severity == "" {
+		al.Severity = domain.SeverityInfo
+	}
+	if al.Kind == "" {
+		al.Kind = domain.KindPrice
+	}
+	if al.Kind.Indicator() {
+		if al.Interval == "" {
+			al.Interval = "1h"
+		}
+		if _, err := history.ParseInterval(al.Interval); err != nil {
+			return al, err
+		}
+	}
+	if !al.HasThreshold() {
+		al.Threshold = 0
+	}
+	if d := al.Kind.Direction(); d != "" {
+		al.Direction = d
+	}
+	if al.Expr != "" && al.Kind == domain.KindPrice {
+		e, err := rules.Parse(al.Expr)
+		if err != nil {
+			return al, err
+		}
+		al.Expr = e.String()
+		al.Symbol = e.Symbols()[0]
+		al.Threshold, al.Direction = 0, ""
 	}
 	if err := domain.ValidateAlert(&al); err != nil {
 		return al, err
 	}
-	return al, a.DB.Create(&al).Error
+	if len(al.Channels) > 0 {
+		ids := make([]string, len(al.Channels))
+		for i, ch := range al.Channels {
+			ids[i] = ch.ID
+		}
+		var chs []domain.Channel
+		if err := a.DB.Where("id IN ?", ids).Find(&chs).Error; err != nil {
+			return al, err
+		}
+		if len(chs) != len(ids) {
+			return al, ErrUnknownChannel
+		}
+		al.Channels = chs
+	}
+	if err := a.DB.Omit("Channels.*").Create(&al).Error; err != nil {
+		return al, err
+	}
+	a.alertsChanged()
+	return al, nil
 }
 
 func (a *App) ToggleAlert(id string, enabled bool) error {
-	return a.DB.Model(&domain.Alert{}).Where("id = ?", id).Update("enabled", enabled).Error
+	res := a.DB.Model(&domain.Alert{}).Where("id = ?", id).Update("enabled", enabled)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return ErrAlertNotFound
+	}
+	a.alertsChanged()
+	return res.Error
 }
 
 func (a *App) DeleteAlert(id string) error {
-	return a.DB.Delete(&domain.Alert{}, "id = ?", id).Error
+	res := a.DB.Select("Channels").Delete(&domain.Alert{ID: id})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return ErrAlertNotFound
+	}
+	a.alertsChanged()
+	return res.Error
+}
+
+// alertsChanged drops the state cached from the alert rows after they were
+// created, edited or deleted.
+func (a *App) alertsChanged() {
+	a.exprs.reset()
+	a.pruneStudies()
 }
 
 func (a *App) ListAlerts() ([]domain.Alert, error) {
 	var list []domain.Alert
-	return list, a.DB.Order("created_at desc").Find(&list).Error
+	return list, a.DB.Preload("Channels").Order("created_at desc").Find(&list).Error
 }
 
-func (a *App) UpsertChannel(kind domain.ChannelKind, enabled bool, cfg any) error {
+// Candles returns stored OHLC candles; see history.Store.Candles.
+func (a *App) Candles(symbol, interval string, from, to time.Time, limit int) ([]domain.Candle, error) {
+	iv, err := history.ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	return a.History.Candles(symbol, iv, from, to, limit)
+}
+
+// Price returns the last Binance price the engine saw for symbol, falling
+// back to a REST lookup for symbols that aren't being streamed.
+func (a *App) Price(ctx context.Context, symbol string) (float64, error) {
+	var lp domain.LastPrice
+	if err := a.DB.First(&lp, "exchange = ? AND symbol = ?", domain.ExchangeBinance, symbol).Error; err == nil {
+		return lp.Price, nil
+	}
+	return a.binance.FetchPrice(ctx, symbol)
+}
+
+// UpsertChannel saves the settings of the channel of kind ch.Kind, with cfg
+// stored as its JSON config, encrypted when a master key is configured, and
+// reloads the notifiers.
+func (a *App) UpsertChannel(ch domain.Channel, cfg any) error {
+	if err := domain.ValidateChannel(&ch); err != nil {
+		return err
+	}
 	js, _ := json.Marshal(cfg)
-	var ch domain.Channel
-	res := a.DB.First(&ch, "kind = ?", kind)
+	sealed, err := a.sealConfig(js)
+	if err != nil {
+		return err
+	}
+	var cur domain.Channel
+	res := a.DB.First(&cur, "kind = ?", ch.Kind)
 	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-		ch = domain.Channel{
-			ID: nuid.Next(), Kind: kind, Enabled: enabled, Config: string(js),
-		}
-		return a.DB.Create(&ch).Error
+		cur = domain.Channel{ID: nuid.Next(), Kind: ch.Kind}
+	} else if res.Error != nil {
+		return res.Error
+	}
+	cur.Enabled = ch.Enabled
+	cur.MinSeverity = ch.MinSeverity
+	cur.Schedule = ch.Schedule
+	cur.Digest = ch.Digest
+	cur.DigestAt = ch.DigestAt
+	cur.DailySummary = ch.DailySummary
+	cur.Config = sealed
+	if err := a.DB.Save(&cur).Error; err != nil {
+		return err
 	}
-	ch.Enabled = enabled
-	ch.Config = string(js)
-	return a.DB.Save(&ch).Error
+	return a.Reload()
 }
 
 func (a *App) ListChannels() ([]domain.Channel, error) {
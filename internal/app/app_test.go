@@ -0,0 +1,1162 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/Secretstar513/crypto-alerts/internal/config"
+	"github.com/Secretstar513/crypto-alerts/internal/db"
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
+	"github.com/Secretstar513/crypto-alerts/internal/notif"
+	"github.com/Secretstar513/crypto-alerts/internal/price"
+	"github.com/Secretstar513/crypto-alerts/internal/price/pricetest"
+	"github.com/Secretstar513/crypto-alerts/internal/secrets"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram/telegramtest"
+)
+
+// capture is a notifier without a channel row, so it receives every alert,
+// unless it is named after a channel kind (see captureChannels).
+type capture struct {
+	name    string
+	off     bool
+	mu      sync.Mutex
+	events  []notif.Event
+	digests []notif.Digest
+}
+
+func (c *capture) Name() string {
+	if c.name == "" {
+		return "capture"
+	}
+	return c.name
+}
+
+func (c *capture) Enabled() bool { return !c.off }
+
+func (c *capture) Notify(_ context.Context, ev notif.Event) error {
+	c.mu.Lock()
+	c.events = append(c.events, ev)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *capture) NotifyDigest(_ context.Context, d notif.Digest) error {
+	c.mu.Lock()
+	c.digests = append(c.digests, d)
+	c.mu.Unlock()
+	return nil
+}
+
+// Titles returns the titles of the digests and system notices received.
+func (c *capture) Titles() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]string, len(c.digests))
+	for i, d := range c.digests {
+		out[i] = d.Title
+	}
+	return out
+}
+
+func (c *capture) Digests() []notif.Digest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]notif.Digest(nil), c.digests...)
+}
+
+func (c *capture) Events() []notif.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]notif.Event(nil), c.events...)
+}
+
+// testConfig returns a config with a private in-memory database, test-sized
+// timings and exchange URLs that nothing listens on.
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.DBPath = fmt.Sprintf("file:%s?mode=memory&cache=shared", nuid.Next())
+	cfg.BinanceWSURL = "ws://127.0.0.1:1"
+	cfg.BinanceRESTURL = "http://127.0.0.1:1"
+	cfg.CoinbaseWSURL = "ws://127.0.0.1:1"
+	cfg.CoinbaseRESTURL = "http://127.0.0.1:1"
+	cfg.TelegramAPIURL = "http://127.0.0.1:1"
+	cfg.PollInterval = 20 * time.Millisecond
+	cfg.ReconnectDelay = 50 * time.Millisecond
+	cfg.ReconnectMaxDelay = 200 * time.Millisecond
+	cfg.EngineTick = 10 * time.Millisecond
+	cfg.StaleAfter = time.Minute
+	cfg.ShutdownTimeout = 5 * time.Second
+	return cfg
+}
+
+// exchangeConfig points the Binance feed at a fake exchange.
+func exchangeConfig(t *testing.T) (*config.Config, *pricetest.Server) {
+	t.Helper()
+	ex := pricetest.NewServer()
+	t.Cleanup(ex.Close)
+	cfg := testConfig()
+	cfg.BinanceWSURL = ex.WSURL()
+	cfg.BinanceRESTURL = ex.URL
+	return cfg, ex
+}
+
+// newTestApp starts an App for cfg that delivers alerts to the returned
+// capture.
+func newTestApp(t *testing.T, cfg *config.Config) (*App, *capture) {
+	t.Helper()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	a := New(cfg)
+	// One connection serialises the engine, history and scheduler goroutines
+	// and keeps the shared in-memory database alive.
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	c := &capture{}
+	a.Notifiers = append(a.Notifiers, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		_ = a.Stop()
+	})
+	return a, c
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitPrice waits until the engine has processed p as symbol's last Binance
+// price.
+func waitPrice(t *testing.T, a *App, symbol string, p float64) {
+	t.Helper()
+	waitExchangePrice(t, a, domain.ExchangeBinance, symbol, p)
+}
+
+func waitExchangePrice(t *testing.T, a *App, exchange, symbol string, p float64) {
+	t.Helper()
+	eventually(t, fmt.Sprintf("%s on %s at %g", symbol, exchange, p), func() bool {
+		var lp domain.LastPrice
+		return a.DB.Where("exchange = ? AND symbol = ?", exchange, symbol).Limit(1).Find(&lp).Error == nil && lp.Price == p
+	})
+}
+
+func waitEvents(t *testing.T, c *capture, n int) []notif.Event {
+	t.Helper()
+	eventually(t, fmt.Sprintf("%d alert(s)", n), func() bool { return len(c.Events()) >= n })
+	evs := c.Events()
+	if len(evs) != n {
+		t.Fatalf("got %d alerts, want %d: %+v", len(evs), n, evs)
+	}
+	return evs
+}
+
+func mustAlert(t *testing.T, a *App, symbol string, dir domain.Direction, thr float64) domain.Alert {
+	t.Helper()
+	al, err := a.CreateAlert(domain.Alert{Symbol: symbol, Direction: dir, Threshold: thr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return al
+}
+
+func TestAlertFiresOnCrossing(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	mustAlert(t, a, "BTCUSDT", domain.DirectionUp, 100)
+	mustAlert(t, a, "BTCUSDT", domain.DirectionDown, 80)
+	eventually(t, "stream", func() bool { return ex.Streams("BTCUSDT") > 0 })
+
+	ex.SetPrice("BTCUSDT", 90)
+	waitPrice(t, a, "BTCUSDT", 90)
+	ex.SetPrice("BTCUSDT", 105)
+	ex.SetPrice("BTCUSDT", 110) // still above: no second fire
+	evs := waitEvents(t, c, 1)
+	if ev := evs[0]; ev.Symbol != "BTCUSDT" || ev.Price != 105 || ev.Threshold != 100 || ev.Direction != "UP" {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+
+	ex.SetPrice("BTCUSDT", 79)
+	evs = waitEvents(t, c, 2)
+	if ev := evs[1]; ev.Price != 79 || ev.Direction != "DOWN" {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+}
+
+// An alert saved by a release from before conditions, kinds and channels
+// must still fire once the schema has been migrated.
+func TestAlertFromOldSchemaFires(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	cfg.DBPath = filepath.Join(t.TempDir(), "alerts.db")
+	old := db.OpenSQLite(cfg.DBPath)
+	for _, stmt := range []string{
+		"CREATE TABLE `alerts` (`id` text,`symbol` text,`threshold` real,`direction` text,`enabled` numeric,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`))",
+		"INSERT INTO alerts VALUES ('old', 'BTCUSDT', 100, 'UP', 1, '2025-09-25 12:00:00', '2025-09-25 12:00:00')",
+	} {
+		if err := old.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sqlDB, err := old.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	a, c := newTestApp(t, cfg)
+	eventually(t, "stream", func() bool { return ex.Streams("BTCUSDT") > 0 })
+	ex.SetPrice("BTCUSDT", 90)
+	waitPrice(t, a, "BTCUSDT", 90)
+	ex.SetPrice("BTCUSDT", 105)
+	if ev := waitEvents(t, c, 1)[0]; ev.Price != 105 || ev.Threshold != 100 {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+}
+
+func TestCompoundCondition(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	if _, err := a.CreateAlert(domain.Alert{Expr: "BTCUSDT > 65000 AND"}); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	al, err := a.CreateAlert(domain.Alert{Expr: "SOLUSDT crosses up 200 while BTCUSDT above 65000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if al.Symbol != "BTCUSDT" {
+		t.Fatalf("symbol = %q, want the first referenced symbol", al.Symbol)
+	}
+	eventually(t, "streams", func() bool { return ex.Streams("BTCUSDT") > 0 && ex.Streams("SOLUSDT") > 0 })
+
+	ex.SetPrice("BTCUSDT", 60000)
+	ex.SetPrice("SOLUSDT", 190)
+	waitPrice(t, a, "BTCUSDT", 60000)
+	waitPrice(t, a, "SOLUSDT", 190)
+	ex.SetPrice("SOLUSDT", 205) // crosses, but BTC is below 65000
+	waitPrice(t, a, "SOLUSDT", 205)
+	ex.SetPrice("SOLUSDT", 195)
+	ex.SetPrice("BTCUSDT", 66000) // BTC condition alone doesn't fire
+	waitPrice(t, a, "SOLUSDT", 195)
+	waitPrice(t, a, "BTCUSDT", 66000)
+	ex.SetPrice("SOLUSDT", 201)
+
+	evs := waitEvents(t, c, 1)
+	if ev := evs[0]; ev.Symbol != "SOLUSDT" || ev.Price != 201 || ev.Condition != al.Expr {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+}
+
+// Parsed conditions are cached, so pausing, resuming, deleting and creating
+// condition alerts must each take effect on the next update.
+func TestConditionFollowsAlertChanges(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	al, err := a.CreateAlert(domain.Alert{Expr: "1INCHUSDT crosses up 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "stream", func() bool { return ex.Streams("1INCHUSDT") > 0 })
+	cross := func(p float64) {
+		ex.SetPrice("1INCHUSDT", 0.9)
+		waitPrice(t, a, "1INCHUSDT", 0.9)
+		ex.SetPrice("1INCHUSDT", p)
+		waitPrice(t, a, "1INCHUSDT", p)
+	}
+
+	cross(1.1)
+	waitEvents(t, c, 1)
+	if err := a.ToggleAlert(al.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	cross(1.2)
+	if err := a.ToggleAlert(al.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	cross(1.3)
+	if evs := waitEvents(t, c, 2); evs[1].Price != 1.3 {
+		t.Fatalf("fired while paused: %+v", evs)
+	}
+
+	if err := a.DeleteAlert(al.ID); err != nil {
+		t.Fatal(err)
+	}
+	cross(1.4)
+	above, err := a.CreateAlert(domain.Alert{Expr: "1INCHUSDT > 1.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.SetPrice("1INCHUSDT", 1.6)
+	evs := waitEvents(t, c, 3)
+	if ev := evs[2]; ev.Price != 1.6 || ev.Condition != above.Expr {
+		t.Fatalf("unexpected alerts after delete and create: %+v", evs)
+	}
+}
+
+func TestRatioAlertAlignsLegs(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	cfg.PairMaxSkew = 100 * time.Millisecond
+	a, c := newTestApp(t, cfg)
+	if _, err := a.CreateAlert(domain.Alert{Kind: domain.KindRatio, Symbol: "ETHUSDT", Direction: domain.DirectionUp, Threshold: 0.05}); err == nil {
+		t.Fatal("expected an error without a second symbol")
+	}
+	_, err := a.CreateAlert(domain.Alert{
+		Kind: domain.KindRatio, Symbol: "ETHUSDT", PairSymbol: "BTCUSDT",
+		Direction: domain.DirectionUp, Threshold: 0.05,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "streams", func() bool { return ex.Streams("ETHUSDT") > 0 && ex.Streams("BTCUSDT") > 0 })
+
+	ex.SetPrice("BTCUSDT", 60000)
+	ex.SetPrice("ETHUSDT", 2900) // 0.0483
+	waitPrice(t, a, "BTCUSDT", 60000)
+	waitPrice(t, a, "ETHUSDT", 2900)
+
+	// ETH moves long after BTC's last update: 3100/60000 would cross, but
+	// the legs are too far apart to combine.
+	time.Sleep(3 * cfg.PairMaxSkew)
+	ex.SetPrice("ETHUSDT", 3100)
+	waitPrice(t, a, "ETHUSDT", 3100)
+	if n := len(c.Events()); n != 0 {
+		t.Fatalf("fired on misaligned legs: %+v", c.Events())
+	}
+
+	ex.SetPrice("BTCUSDT", 61000) // 3100/61000 = 0.0508
+	evs := waitEvents(t, c, 1)
+	if ev := evs[0]; ev.Symbol != "ETHUSDT/BTCUSDT" || ev.Price != 3100.0/61000 || ev.Direction != "UP" {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+}
+
+// A spread of exactly 0 is a real previous value, not a missing one.
+func TestSpreadAlertStartingAtZero(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	_, err := a.CreateAlert(domain.Alert{
+		Kind: domain.KindSpread, Symbol: "USDCUSDT", PairSymbol: "FDUSDUSDT",
+		Direction: domain.DirectionUp, Threshold: 0.125,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "streams", func() bool { return ex.Streams("USDCUSDT") > 0 && ex.Streams("FDUSDUSDT") > 0 })
+
+	ex.SetPrice("FDUSDUSDT", 1)
+	ex.SetPrice("USDCUSDT", 1) // spread 0
+	waitPrice(t, a, "FDUSDUSDT", 1)
+	waitPrice(t, a, "USDCUSDT", 1)
+
+	ex.SetPrice("USDCUSDT", 1.25)
+	evs := waitEvents(t, c, 1)
+	if ev := evs[0]; ev.Symbol != "USDCUSDT-FDUSDUSDT" || ev.Price != 0.25 {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+}
+
+func TestArbitrageAlertAcrossExchanges(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	cb := pricetest.NewServer()
+	t.Cleanup(cb.Close)
+	cfg.CoinbaseWSURL = cb.WSURL()
+	cfg.CoinbaseRESTURL = cb.URL
+	a, c := newTestApp(t, cfg)
+	_, err := a.CreateAlert(domain.Alert{
+		Kind: domain.KindArbitrage, Symbol: "BTCUSDT",
+		Exchange: domain.ExchangeBinance, PairExchange: domain.ExchangeCoinbase,
+		Direction: domain.DirectionUp, Threshold: 0.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "streams", func() bool { return ex.Streams("BTCUSDT") > 0 && cb.Streams("BTCUSDT") > 0 })
+
+	ex.SetPrice("BTCUSDT", 60000)
+	cb.SetPrice("BTCUSDT", 60100) // 0.17%
+	waitPrice(t, a, "BTCUSDT", 60000)
+	waitExchangePrice(t, a, domain.ExchangeCoinbase, "BTCUSDT", 60100)
+	if p, _ := a.Price(context.Background(), "BTCUSDT"); p != 60000 {
+		t.Fatalf("Price = %g, want the Binance price", p)
+	}
+
+	cb.SetPrice("BTCUSDT", 59500) // 0.84%
+	evs := waitEvents(t, c, 1)
+	if ev := evs[0]; ev.Symbol != "BTCUSDT@binance~coinbase" || ev.Price != 500.0/59500*100 {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+
+	feeds, err := a.FeedStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 2 || feeds[0].Exchange != "binance" || feeds[1].Exchange != "coinbase" || feeds[1].Alerts != 1 {
+		t.Fatalf("unexpected feeds %+v", feeds)
+	}
+}
+
+func TestSMAAlertWarmsUpFromCandles(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	bar := time.Now().UTC().Truncate(time.Minute)
+	for i := 1; i <= 2; i++ {
+		err := a.DB.Create(&domain.Candle{
+			Symbol: "BTCUSDT", Interval: "1m", OpenTime: bar.Add(-time.Duration(i) * time.Minute),
+			Open: 100, High: 100, Low: 100, Close: 100, Count: 1,
+		}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := a.CreateAlert(domain.Alert{
+		Kind: domain.KindEMACross, Symbol: "BTCUSDT", Interval: "1m", Period: 5, SlowPeriod: 5, Direction: domain.DirectionUp,
+	}); err == nil {
+		t.Fatal("expected an error for a slow period no longer than the fast one")
+	}
+	_, err := a.CreateAlert(domain.Alert{
+		Kind: domain.KindSMA, Symbol: "BTCUSDT", Interval: "1m", Period: 3, Direction: domain.DirectionUp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "stream", func() bool { return ex.Streams("BTCUSDT") > 0 })
+
+	// Two closed candles at 100 and the forming one make the 3-period SMA.
+	ex.SetPrice("BTCUSDT", 95) // SMA 98.33, price below
+	waitPrice(t, a, "BTCUSDT", 95)
+	if n := len(c.Events()); n != 0 {
+		t.Fatalf("fired below the SMA: %+v", c.Events())
+	}
+	ex.SetPrice("BTCUSDT", 105) // SMA 101.67 (100 if a minute passed), price above
+	evs := waitEvents(t, c, 1)
+	if ev := evs[0]; ev.Symbol != "BTCUSDT SMA(3) 1m" || ev.Price != 105 || ev.Threshold >= 105 || ev.Direction != "UP" {
+		t.Fatalf("unexpected alert %+v", ev)
+	}
+}
+
+func TestIndicatorStudiesFollowAlerts(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, _ := newTestApp(t, cfg)
+	studies := func() []string {
+		a.studies.mu.Lock()
+		defer a.studies.mu.Unlock()
+		var out []string
+		for series := range a.studies.series {
+			out = append(out, series)
+		}
+		sort.Strings(out)
+		return out
+	}
+	mk := func(kind domain.AlertKind) domain.Alert {
+		al, err := a.CreateAlert(domain.Alert{Kind: kind, Symbol: "ETHUSDT", Interval: "1m", Period: 3, Direction: domain.DirectionUp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return al
+	}
+	sma, sma2, ema := mk(domain.KindSMA), mk(domain.KindSMA), mk(domain.KindEMA)
+	eventually(t, "stream", func() bool { return ex.Streams("ETHUSDT") > 0 })
+	ex.SetPrice("ETHUSDT", 3000)
+	eventually(t, "studies", func() bool { return len(studies()) == 2 })
+
+	// The SMA series stays while another alert uses it.
+	if err := a.ToggleAlert(sma.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := studies(); len(got) != 2 {
+		t.Fatalf("studies after pausing one SMA alert = %v", got)
+	}
+	if err := a.DeleteAlert(sma2.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := studies(); !reflect.DeepEqual(got, []string{ema.Series()}) {
+		t.Fatalf("studies after the SMA alerts went = %v, want only %s", got, ema.Series())
+	}
+	if err := a.DeleteAlert(ema.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := studies(); len(got) != 0 {
+		t.Fatalf("studies after deleting every alert = %v", got)
+	}
+}
+
+func TestDailyStatsAlerts(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	for _, al := range []domain.Alert{
+		{Kind: domain.KindHigh, Symbol: "BTCUSDT"},
+		{Kind: domain.KindVolume, Symbol: "BTCUSDT", Direction: domain.DirectionUp, Threshold: 1.5e6},
+		{Kind: domain.KindChange, Symbol: "BTCUSDT", Direction: domain.DirectionDown, Threshold: -5},
+	} {
+		if _, err := a.CreateAlert(al); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually(t, "stream", func() bool { return ex.Streams("BTCUSDT") > 0 })
+
+	ex.SetTicker("BTCUSDT", 100, price.Stats{High: 105, Low: 90, QuoteVolume: 1e6, ChangePercent: 1})
+	waitPrice(t, a, "BTCUSDT", 100)
+	ex.SetTicker("BTCUSDT", 106, price.Stats{High: 106, Low: 90, QuoteVolume: 2e6, ChangePercent: 2})
+	evs := waitEvents(t, c, 2)
+	got := map[string]notif.Event{}
+	for _, ev := range evs {
+		got[ev.Symbol] = ev
+	}
+	if ev := got["BTCUSDT 24h high"]; ev.Price != 106 || ev.Threshold != 105 || ev.Direction != "UP" {
+		t.Fatalf("unexpected high alert %+v", evs)
+	}
+	if ev := got["BTCUSDT 24h volume"]; ev.Price != 2e6 {
+		t.Fatalf("unexpected volume alert %+v", evs)
+	}
+
+	// Still at the high: no new breakout until the price dips and returns.
+	ex.SetTicker("BTCUSDT", 107, price.Stats{High: 107, Low: 90, QuoteVolume: 2e6, ChangePercent: 2})
+	waitPrice(t, a, "BTCUSDT", 107)
+	if n := len(c.Events()); n != 2 {
+		t.Fatalf("fired again while at the high: %+v", c.Events())
+	}
+}
+
+func TestToggleAlertMidStream(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	al := mustAlert(t, a, "ETHUSDT", domain.DirectionUp, 100)
+	eventually(t, "stream", func() bool { return ex.Streams("ETHUSDT") > 0 })
+
+	ex.SetPrice("ETHUSDT", 90)
+	waitPrice(t, a, "ETHUSDT", 90)
+	ex.SetPrice("ETHUSDT", 110)
+	waitEvents(t, c, 1)
+
+	if err := a.ToggleAlert(al.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	ex.SetPrice("ETHUSDT", 90)
+	ex.SetPrice("ETHUSDT", 111)
+	waitPrice(t, a, "ETHUSDT", 111)
+
+	if err := a.ToggleAlert(al.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	ex.SetPrice("ETHUSDT", 90)
+	waitPrice(t, a, "ETHUSDT", 90)
+	ex.SetPrice("ETHUSDT", 112)
+	// The engine handles updates in order, so a fire while disabled would
+	// already be captured by now.
+	evs := waitEvents(t, c, 2)
+	if evs[1].Price != 112 {
+		t.Fatalf("fired while disabled: %+v", evs)
+	}
+}
+
+func TestFallbackToHTTP(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	ex.RejectStreams(true)
+	a, c := newTestApp(t, cfg)
+	mustAlert(t, a, "SOLUSDT", domain.DirectionUp, 100)
+
+	ex.SetPrice("SOLUSDT", 90)
+	waitPrice(t, a, "SOLUSDT", 90)
+	ex.SetPrice("SOLUSDT", 110)
+	waitEvents(t, c, 1)
+
+	if ex.Dials() == 0 || ex.Streams("SOLUSDT") != 0 || ex.RESTHits() == 0 {
+		t.Fatalf("dials=%d streams=%d rest=%d", ex.Dials(), ex.Streams("SOLUSDT"), ex.RESTHits())
+	}
+}
+
+func TestUpdatesResumeAfterStreamDrop(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	mustAlert(t, a, "BTCUSDT", domain.DirectionUp, 100)
+	eventually(t, "stream", func() bool { return ex.Streams("BTCUSDT") > 0 })
+
+	ex.SetPrice("BTCUSDT", 90)
+	waitPrice(t, a, "BTCUSDT", 90)
+	ex.DropStreams()
+	eventually(t, "drop", func() bool { return ex.Streams("BTCUSDT") == 0 })
+
+	ex.SetPrice("BTCUSDT", 110)
+	evs := waitEvents(t, c, 1)
+	if evs[0].Price != 110 {
+		t.Fatalf("unexpected alert %+v", evs[0])
+	}
+
+	// Polling covers the gap; the stream itself comes back after a backoff.
+	eventually(t, "reconnect", func() bool { return ex.Streams("BTCUSDT") > 0 })
+	ex.SetPrice("BTCUSDT", 120)
+	eventually(t, "streaming", func() bool { return streamState(a, "BTCUSDT") == price.StateStreaming })
+}
+
+func TestStreamRestoredAfterOutage(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	ex.RejectStreams(true)
+	a, _ := newTestApp(t, cfg)
+	mustAlert(t, a, "BTCUSDT", domain.DirectionUp, 100)
+	ex.SetPrice("BTCUSDT", 90)
+
+	eventually(t, "polling", func() bool { return streamState(a, "BTCUSDT") == price.StatePolling })
+	failed := ex.Dials()
+	eventually(t, "retries", func() bool { return ex.Dials() >= failed+2 })
+
+	ex.RejectStreams(false)
+	eventually(t, "reconnect", func() bool { return ex.Streams("BTCUSDT") > 0 })
+	ex.SetPrice("BTCUSDT", 95)
+	eventually(t, "streaming", func() bool { return streamState(a, "BTCUSDT") == price.StateStreaming })
+	waitPrice(t, a, "BTCUSDT", 95)
+}
+
+func streamState(a *App, symbol string) price.State {
+	for _, st := range a.Router.Status() {
+		if st.Symbol == symbol {
+			return st.State
+		}
+	}
+	return ""
+}
+
+func TestReplayFeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.jsonl")
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var lines string
+	for i, p := range []float64{98, 99, 101, 100, 97} {
+		lines += fmt.Sprintf(`{"time":%q,"symbol":"BTCUSDT","price":%g}`+"\n",
+			start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339), p)
+	}
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig()
+	cfg.PriceReplayFile = path
+	cfg.PriceReplaySpeed = 0
+
+	a, c := newTestApp(t, cfg)
+	mustAlert(t, a, "BTCUSDT", domain.DirectionUp, 100)
+	mustAlert(t, a, "BTCUSDT", domain.DirectionDown, 98)
+	waitPrice(t, a, "BTCUSDT", 97)
+
+	evs := waitEvents(t, c, 2)
+	if evs[0].Price != 101 || evs[1].Price != 97 {
+		t.Fatalf("unexpected alerts %+v", evs)
+	}
+}
+
+func TestStaleFeedNotification(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	cfg.StaleAfter = 100 * time.Millisecond
+	ex.RejectStreams(true)
+	ex.FailREST(true)
+	a, c := newTestApp(t, cfg)
+	mustAlert(t, a, "BTCUSDT", domain.DirectionUp, 100)
+
+	eventually(t, "stale notice", func() bool { return len(c.Titles()) > 0 })
+	if got := c.Titles(); got[0] != "Stale feed: BTCUSDT" {
+		t.Fatalf("unexpected notices %q", got)
+	}
+	feeds, err := a.FeedStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || !feeds[0].Stale || feeds[0].Alerts != 1 || feeds[0].LastError == "" {
+		t.Fatalf("unexpected status %+v", feeds)
+	}
+
+	ex.SetPrice("BTCUSDT", 90)
+	ex.FailREST(false)
+	eventually(t, "recovery notice", func() bool { return len(c.Titles()) > 1 })
+	if got := c.Titles(); len(got) != 2 || got[1] != "Feed recovered: BTCUSDT" {
+		t.Fatalf("unexpected notices %q", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	fired := testutil.ToFloat64(metrics.AlertsFired.WithLabelValues("XRPUSDT", "PRICE", "INFO"))
+	sent := testutil.ToFloat64(metrics.Notifications.WithLabelValues("capture", "sent"))
+
+	cfg, ex := exchangeConfig(t)
+	a, c := newTestApp(t, cfg)
+	mustAlert(t, a, "XRPUSDT", domain.DirectionUp, 1)
+	eventually(t, "stream", func() bool { return ex.Streams("XRPUSDT") > 0 })
+	ex.SetPrice("XRPUSDT", 0.9)
+	waitPrice(t, a, "XRPUSDT", 0.9)
+	ex.SetPrice("XRPUSDT", 1.1)
+	waitEvents(t, c, 1)
+
+	if got := testutil.ToFloat64(metrics.AlertsFired.WithLabelValues("XRPUSDT", "PRICE", "INFO")) - fired; got != 1 {
+		t.Errorf("alerts_fired_total grew by %g, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.Notifications.WithLabelValues("capture", "sent")) - sent; got != 1 {
+		t.Errorf("notifications_total{outcome=sent} grew by %g, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.PriceUpdates.WithLabelValues(price.ExchangeBinance, "XRPUSDT", price.TransportWS)); got < 2 {
+		t.Errorf("price_updates_total = %g, want at least 2", got)
+	}
+}
+
+func TestReady(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	ex.RejectStreams(true)
+	ex.FailREST(true)
+	a, _ := newTestApp(t, cfg)
+	ctx := context.Background()
+
+	eventually(t, "ready without alerts", func() bool { return a.Ready(ctx) == nil })
+
+	mustAlert(t, a, "BTCUSDT", domain.DirectionUp, 100)
+	if err := a.Ready(ctx); err == nil || !strings.HasPrefix(err.Error(), "feeds:") {
+		t.Fatalf("Ready() = %v, want a feeds error", err)
+	}
+
+	ex.SetPrice("BTCUSDT", 90)
+	ex.FailREST(false)
+	eventually(t, "ready with a live feed", func() bool { return a.Ready(ctx) == nil })
+}
+
+// slow is a notifier whose sends take delay, or until ctx is cancelled.
+type slow struct {
+	delay   time.Duration
+	started chan struct{}
+	mu      sync.Mutex
+	err     error
+	done    bool
+}
+
+func (n *slow) Name() string  { return "slow" }
+func (n *slow) Enabled() bool { return true }
+
+func (n *slow) Notify(ctx context.Context, _ notif.Event) error {
+	close(n.started)
+	var err error
+	select {
+	case <-time.After(n.delay):
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	n.mu.Lock()
+	n.err, n.done = err, true
+	n.mu.Unlock()
+	return err
+}
+
+func (n *slow) result() (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.done, n.err
+}
+
+// fireSlow starts an app whose only extra notifier is n and blocks until an
+// alert is being sent through it.
+func fireSlow(t *testing.T, cfg *config.Config, ex *pricetest.Server, n *slow) *App {
+	t.Helper()
+	a, _ := newTestApp(t, cfg)
+	a.mu.Lock()
+	a.Notifiers = append(a.Notifiers, n)
+	a.mu.Unlock()
+	mustAlert(t, a, "BTCUSDT", domain.DirectionUp, 100)
+	eventually(t, "stream", func() bool { return ex.Streams("BTCUSDT") > 0 })
+	ex.SetPrice("BTCUSDT", 90)
+	waitPrice(t, a, "BTCUSDT", 90)
+	ex.SetPrice("BTCUSDT", 110)
+	select {
+	case <-n.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert never reached the slow notifier")
+	}
+	return a
+}
+
+func TestStopDrainsInFlightNotification(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	n := &slow{delay: 200 * time.Millisecond, started: make(chan struct{})}
+	a := fireSlow(t, cfg, ex, n)
+
+	if err := a.Stop(); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	if done, err := n.result(); !done || err != nil {
+		t.Fatalf("send finished=%v err=%v, want a completed send", done, err)
+	}
+	if err := a.DB.Exec("SELECT 1").Error; err == nil {
+		t.Fatal("database still open after Stop")
+	}
+}
+
+func TestStopCancelsSendsAfterDeadline(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	cfg.ShutdownTimeout = 50 * time.Millisecond
+	n := &slow{delay: time.Minute, started: make(chan struct{})}
+	a := fireSlow(t, cfg, ex, n)
+
+	start := time.Now()
+	if err := a.Stop(); err == nil {
+		t.Fatal("Stop() = nil, want a deadline error")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Stop took %s despite a 50ms deadline", d)
+	}
+	eventually(t, "the send to be cancelled", func() bool {
+		done, err := n.result()
+		return done && errors.Is(err, context.Canceled)
+	})
+}
+
+func TestShutdownUsesCallerDeadline(t *testing.T) {
+	cfg, ex := exchangeConfig(t)
+	cfg.ShutdownTimeout = time.Minute
+	n := &slow{delay: time.Minute, started: make(chan struct{})}
+	a := fireSlow(t, cfg, ex, n)
+	var extra atomic.Bool
+	a.Go(func() {
+		time.Sleep(20 * time.Millisecond)
+		extra.Store(true)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := a.Shutdown(ctx); err == nil {
+		t.Fatal("Shutdown() = nil, want a deadline error")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Shutdown took %s despite a 50ms deadline", d)
+	}
+	if !extra.Load() {
+		t.Fatal("Shutdown returned before a goroutine started with Go")
+	}
+}
+
+func TestChannelSecretsEncrypted(t *testing.T) {
+	cfg := testConfig()
+	oldKey, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SecretsKey = oldKey
+	a, _ := newTestApp(t, cfg)
+
+	ch := domain.Channel{Kind: domain.ChannelTelegram, Enabled: true}
+	if err := a.UpsertChannel(ch, notif.TelegramConfig{BotToken: "123:SECRET", ChatID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	stored := func() string {
+		saved, err := a.channel(domain.ChannelTelegram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return saved.Config
+	}
+	first := stored()
+	if !secrets.IsSealed(first) || strings.Contains(first, "SECRET") {
+		t.Fatalf("config stored in plaintext: %q", first)
+	}
+
+	// Rotate: the old key becomes a previous key and startup re-wraps.
+	if cfg.SecretsKey, err = secrets.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.SecretsPreviousKeys = oldKey
+	keys, err := cfg.Keyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.keys = keys
+	if err := a.sealChannels(); err != nil {
+		t.Fatal(err)
+	}
+	if rotated := stored(); rotated == first || keys.Stale(rotated) {
+		t.Fatalf("config not re-wrapped under the new key: %q", rotated)
+	}
+
+	// Without the old key the rotated config still opens.
+	cfg.SecretsPreviousKeys = ""
+	if a.keys, err = cfg.Keyring(); err != nil {
+		t.Fatal(err)
+	}
+	var got notif.TelegramConfig
+	if ok, err := a.ChannelConfig(domain.ChannelTelegram, &got); err != nil || !ok {
+		t.Fatalf("ChannelConfig: %v %v", ok, err)
+	}
+	if got.BotToken != "123:SECRET" || got.ChatID != "42" {
+		t.Fatalf("unexpected config %+v", got)
+	}
+
+	a.keys = nil
+	if err := a.sealChannels(); !errors.Is(err, secrets.ErrNoKey) {
+		t.Fatalf("expected ErrNoKey without a key, got %v", err)
+	}
+}
+
+func TestDailySummaryRetriedAfterFailedSend(t *testing.T) {
+	tg := telegramtest.NewServer()
+	t.Cleanup(tg.Close)
+	cfg := testConfig()
+	cfg.TelegramAPIURL = tg.URL
+	a, _ := newTestApp(t, cfg)
+
+	ch := domain.Channel{Kind: domain.ChannelTelegram, Enabled: true, DailySummary: true, DigestAt: "00:00"}
+	if err := a.UpsertChannel(ch, notif.TelegramConfig{BotToken: "1:TOKEN", ChatID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := a.channel(domain.ChannelTelegram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(i int) string {
+		s, _ := tg.Sent()[i].Body["text"].(string)
+		return s
+	}
+
+	// The first pass starts the summary period but still flushes what the
+	// channel was holding.
+	now := time.Now()
+	if err := a.queue(saved.ID, notif.Event{Symbol: "BTCUSDT", Price: 70000, Threshold: 69000, Direction: "UP", Time: now}); err != nil {
+		t.Fatal(err)
+	}
+	a.flushQueued(context.Background(), now)
+	if sent := tg.Sent(); len(sent) != 1 || !strings.Contains(text(0), "BTCUSDT UP @ 70000") {
+		t.Fatalf("queued alert not flushed on the first pass: %v", sent)
+	}
+
+	a.observe("BTCUSDT", 100)
+	a.observe("BTCUSDT", 110)
+	tg.FailNext(500, "Internal Server Error", 0)
+	next := now.Add(25 * time.Hour)
+	a.flushQueued(context.Background(), next)
+	if n := len(tg.Sent()); n != 1 {
+		t.Fatalf("got %d messages after a failed send, want 1", n)
+	}
+
+	a.observe("BTCUSDT", 90)
+	a.flushQueued(context.Background(), next)
+	if n := len(tg.Sent()); n != 2 {
+		t.Fatalf("summary not retried: got %d messages, want 2", n)
+	}
+	if got := text(1); !strings.Contains(got, "BTCUSDT O 100 H 110 L 90 C 90") {
+		t.Fatalf("retried summary lost the failed period: %q", got)
+	}
+}
+
+// captureChannels saves chs and swaps every channel's notifier for a capture
+// of the same name that is enabled like its channel.
+func captureChannels(t *testing.T, a *App, chs ...domain.Channel) map[domain.ChannelKind]*capture {
+	t.Helper()
+	for _, ch := range chs {
+		if err := a.UpsertChannel(ch, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := map[domain.ChannelKind]*capture{}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Notifiers = nil
+	for _, kind := range channelKinds {
+		name := strings.ToLower(string(kind))
+		c := &capture{name: name, off: !a.channels[name].Enabled}
+		a.Notifiers = append(a.Notifiers, c)
+		out[kind] = c
+	}
+	return out
+}
+
+// pending counts the alerts the channel of kind is holding.
+func pending(t *testing.T, a *App, kind domain.ChannelKind) int64 {
+	t.Helper()
+	var n int64
+	err := a.DB.Model(&domain.PendingEvent{}).
+		Where("channel_id = (SELECT id FROM channels WHERE kind = ?)", kind).Count(&n).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestQuietHours(t *testing.T) {
+	a, _ := newTestApp(t, testConfig())
+	office := domain.Schedule{From: "08:00", To: "22:00"}
+	tgSchedule, emailSchedule := office, office
+	tgSchedule.CriticalOverride = true
+	emailSchedule.QuietPolicy = domain.QuietDrop
+	caps := captureChannels(t, a,
+		domain.Channel{Kind: domain.ChannelLog},
+		domain.Channel{Kind: domain.ChannelTelegram, Enabled: true, Schedule: tgSchedule},
+		domain.Channel{Kind: domain.ChannelEmail, Enabled: true, Schedule: emailSchedule},
+	)
+	tg, email := caps[domain.ChannelTelegram], caps[domain.ChannelEmail]
+
+	night := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	clock := night
+	a.now = func() time.Time { return clock }
+	info := domain.Alert{Symbol: "BTCUSDT", Direction: domain.DirectionUp, Threshold: 100, Severity: domain.SeverityInfo}
+	critical := info
+	critical.Severity = domain.SeverityCritical
+	ctx := context.Background()
+
+	// Outside the window telegram queues the alert and email drops it.
+	a.fire(ctx, info, "BTCUSDT", 101)
+	if len(tg.Events()) != 0 || len(email.Events()) != 0 {
+		t.Fatalf("delivered during quiet hours: telegram %v, email %v", tg.Events(), email.Events())
+	}
+	if n := pending(t, a, domain.ChannelTelegram); n != 1 {
+		t.Fatalf("telegram holds %d alert(s), want 1", n)
+	}
+	if n := pending(t, a, domain.ChannelEmail); n != 0 {
+		t.Fatalf("email queued %d alert(s) despite its drop policy", n)
+	}
+
+	// CRITICAL goes out at once where the channel overrides quiet hours.
+	a.fire(ctx, critical, "BTCUSDT", 102)
+	if evs := tg.Events(); len(evs) != 1 || evs[0].Severity != "CRITICAL" {
+		t.Fatalf("telegram got %v, want the CRITICAL alert", evs)
+	}
+	if len(email.Events()) != 0 || pending(t, a, domain.ChannelTelegram) != 1 {
+		t.Fatalf("CRITICAL alert reached email or the queue")
+	}
+
+	// Nothing is flushed before the window opens...
+	a.flushQueued(ctx, night.Add(2*time.Hour))
+	if d := tg.Digests(); len(d) != 0 {
+		t.Fatalf("flushed during quiet hours: %v", d)
+	}
+	// ...and everything held once it does.
+	a.flushQueued(ctx, night.Add(5*time.Hour+30*time.Minute))
+	d := tg.Digests()
+	if len(d) != 1 || d[0].Title != "1 alert(s) held during quiet hours" {
+		t.Fatalf("telegram got digests %v", d)
+	}
+	if evs := d[0].Events; len(evs) != 1 || evs[0].Price != 101 || !evs[0].Time.Equal(night) {
+		t.Fatalf("digest holds %+v, want the INFO alert fired at %s", evs, night)
+	}
+	if n := pending(t, a, domain.ChannelTelegram); n != 0 {
+		t.Fatalf("%d alert(s) still held after the flush", n)
+	}
+	if len(email.Digests()) != 0 {
+		t.Fatalf("email got digests %v", email.Digests())
+	}
+
+	// Inside the window both channels deliver at once.
+	clock = night.Add(6 * time.Hour)
+	a.fire(ctx, info, "BTCUSDT", 103)
+	if len(tg.Events()) != 2 || len(email.Events()) != 1 {
+		t.Fatalf("in-window alert: telegram %v, email %v", tg.Events(), email.Events())
+	}
+	if caps[domain.ChannelLog].Events() != nil {
+		t.Fatal("disabled log channel received alerts")
+	}
+}
+
+func TestAlertChannels(t *testing.T) {
+	a, _ := newTestApp(t, testConfig())
+	caps := captureChannels(t, a,
+		domain.Channel{Kind: domain.ChannelLog, Enabled: true},
+		domain.Channel{Kind: domain.ChannelTelegram, Enabled: true},
+		domain.Channel{Kind: domain.ChannelEmail},
+	)
+	chs, err := a.ListChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := map[domain.ChannelKind]domain.Channel{}
+	for _, ch := range chs {
+		byKind[ch.Kind] = ch
+	}
+
+	for _, tc := range []struct {
+		name   string
+		ticked []domain.ChannelKind
+		want   []domain.ChannelKind // in channelKinds order
+	}{
+		{"none ticked", nil, []domain.ChannelKind{domain.ChannelLog, domain.ChannelTelegram}},
+		{"one ticked", []domain.ChannelKind{domain.ChannelTelegram}, []domain.ChannelKind{domain.ChannelTelegram}},
+		{"disabled ticked", []domain.ChannelKind{domain.ChannelEmail, domain.ChannelLog}, []domain.ChannelKind{domain.ChannelLog}},
+	} {
+		al := domain.Alert{Symbol: "BTCUSDT", Direction: domain.DirectionUp, Threshold: 100, Severity: domain.SeverityInfo}
+		for _, k := range tc.ticked {
+			al.Channels = append(al.Channels, byKind[k])
+		}
+		before := map[domain.ChannelKind]int{}
+		for k, c := range caps {
+			before[k] = len(c.Events())
+		}
+		a.fire(context.Background(), al, "BTCUSDT", 101)
+		var got []domain.ChannelKind
+		for _, k := range channelKinds {
+			if len(caps[k].Events()) > before[k] {
+				got = append(got, k)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: delivered to %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestChannelMinSeverity(t *testing.T) {
+	a, _ := newTestApp(t, testConfig())
+	caps := captureChannels(t, a,
+		domain.Channel{Kind: domain.ChannelLog, Enabled: true},
+		domain.Channel{Kind: domain.ChannelTelegram, Enabled: true, MinSeverity: domain.SeverityCritical},
+	)
+	logc, tg := caps[domain.ChannelLog], caps[domain.ChannelTelegram]
+
+	al := domain.Alert{Symbol: "BTCUSDT", Direction: domain.DirectionUp, Threshold: 100}
+	for _, sev := range []domain.Severity{domain.SeverityInfo, domain.SeverityWarning, domain.SeverityCritical} {
+		al.Severity = sev
+		a.fire(context.Background(), al, "BTCUSDT", 101)
+	}
+	if n := len(logc.Events()); n != 3 {
+		t.Fatalf("log got %d alerts, want all 3", n)
+	}
+	if evs := tg.Events(); len(evs) != 1 || evs[0].Severity != "CRITICAL" {
+		t.Fatalf("CRITICAL-only telegram got %+v", evs)
+	}
+}
+
+func TestTelegramConfigFollowsChannel(t *testing.T) {
+	cfg := testConfig()
+	cfg.TelegramBotToken, cfg.TelegramChatID = "1:ENV", "7"
+	a, _ := newTestApp(t, cfg)
+
+	got, err := a.TelegramConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (notif.TelegramConfig{APIURL: cfg.TelegramAPIURL, BotToken: "1:ENV", ChatID: "7"}); got != want {
+		t.Fatalf("unsaved channel: %+v, want the env config %+v", got, want)
+	}
+
+	saved := notif.TelegramConfig{BotToken: "2:UI", ChatID: "42, -1001:7", ParseMode: "HTML"}
+	if err := a.UpsertChannel(domain.Channel{Kind: domain.ChannelTelegram, Enabled: true}, saved); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = a.TelegramConfig(); err != nil {
+		t.Fatal(err)
+	}
+	saved.APIURL = cfg.TelegramAPIURL
+	if got != saved {
+		t.Fatalf("saved channel: %+v, want %+v", got, saved)
+	}
+}
@@ -0,0 +1,278 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/notif"
+	"github.com/Secretstar513/crypto-alerts/internal/secrets"
+)
+
+var channelKinds = []domain.ChannelKind{domain.ChannelLog, domain.ChannelEmail, domain.ChannelTelegram}
+
+// seedChannels creates a row for every channel kind so alerts can reference
+// it. Seeded rows have an empty config, meaning "use the env settings".
+func (a *App) seedChannels() error {
+	for _, kind := range channelKinds {
+		ch, err := a.channel(kind)
+		if err != nil {
+			return err
+		}
+		if ch != nil {
+			continue
+		}
+		if err := a.DB.Create(&domain.Channel{ID: nuid.Next(), Kind: kind, Enabled: true}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reload rebuilds the notifiers from the saved channel configs so changes made
+// on the channels page take effect without a restart.
+func (a *App) Reload() error {
+	notifs := make([]notif.Notifier, 0, len(channelKinds))
+	byName := map[string]domain.Channel{}
+	for _, kind := range channelKinds {
+		ch, err := a.channel(kind)
+		if err != nil {
+			return err
+		}
+		n, err := a.newNotifier(kind, ch)
+		if err != nil {
+			return err
+		}
+		notifs = append(notifs, n)
+		if ch != nil {
+			byName[n.Name()] = *ch
+		}
+	}
+	a.mu.Lock()
+	a.Notifiers = notifs
+	a.channels = byName
+	a.mu.Unlock()
+	// Cached alerts carry their channels, which may have changed.
+	a.alertsChanged()
+	return nil
+}
+
+// target is a notifier together with its channel row, nil for notifiers that
+// aren't backed by a channel.
+type target struct {
+	n  notif.Notifier
+	ch *domain.Channel
+}
+
+// targets returns the notifiers al should be delivered to: its selected
+// channels (all of them when none are selected) whose minimum severity the
+// alert meets. Notifiers without a channel row receive every alert.
+func (a *App) targets(al domain.Alert) []target {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var out []target
+	for _, n := range a.Notifiers {
+		ch, ok := a.channels[n.Name()]
+		if !ok {
+			out = append(out, target{n: n})
+			continue
+		}
+		if al.Severity.Rank() < ch.MinSeverity.Rank() {
+			continue
+		}
+		if len(al.Channels) == 0 || hasChannel(al.Channels, ch.ID) {
+			out = append(out, target{n: n, ch: &ch})
+		}
+	}
+	return out
+}
+
+func hasChannel(chs []domain.Channel, id string) bool {
+	for _, ch := range chs {
+		if ch.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TestChannel sends a synthetic event through the channel of the given kind
+// only, returning whatever error the delivery produced.
+func (a *App) TestChannel(ctx context.Context, kind domain.ChannelKind) error {
+	ch, err := a.channel(kind)
+	if err != nil {
+		return err
+	}
+	n, err := a.newNotifier(kind, ch)
+	if err != nil {
+		return err
+	}
+	if !n.Enabled() {
+		return ErrChannelDisabled
+	}
+	return n.Notify(ctx, notif.Event{
+		Symbol:    "BTCUSDT",
+		Price:     70000,
+		Threshold: 69999,
+		Direction: string(domain.DirectionUp),
+		Severity:  string(domain.SeverityInfo),
+		Test:      true,
+	})
+}
+
+// channel returns the saved row for kind, or nil if it was never saved.
+func (a *App) channel(kind domain.ChannelKind) (*domain.Channel, error) {
+	var chs []domain.Channel
+	if err := a.DB.Where("kind = ?", kind).Limit(1).Find(&chs).Error; err != nil {
+		return nil, err
+	}
+	if len(chs) == 0 {
+		return nil, nil
+	}
+	return &chs[0], nil
+}
+
+// newNotifier builds the notifier for kind from its saved config, falling back
+// to the env config for channels that haven't been saved through the UI.
+func (a *App) newNotifier(kind domain.ChannelKind, ch *domain.Channel) (notif.Notifier, error) {
+	enabled := true
+	if ch != nil {
+		enabled = ch.Enabled
+	}
+	switch kind {
+	case domain.ChannelLog:
+		return notif.NewLog(enabled), nil
+	case domain.ChannelEmail:
+		cfg := notif.EmailConfig{
+			Host: a.Cfg.SMTPHost, Port: a.Cfg.SMTPPort, User: a.Cfg.SMTPUser, Pass: a.Cfg.SMTPPass,
+			From: a.Cfg.EmailFrom, To: a.Cfg.EmailTo,
+		}
+		if ch != nil && ch.Config != "" {
+			cfg = notif.EmailConfig{}
+			if err := a.decodeConfig(ch.Config, &cfg); err != nil {
+				return nil, fmt.Errorf("email channel config: %w", err)
+			}
+		}
+		return notif.NewEmail(cfg, enabled), nil
+	case domain.ChannelTelegram:
+		cfg, err := a.telegramConfig(ch)
+		if err != nil {
+			return nil, err
+		}
+		return notif.NewTelegram(cfg, enabled), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownChannel, kind)
+}
+
+// TelegramConfig returns the bot settings the Telegram channel delivers with,
+// so the command bot listens with the same token and chats.
+func (a *App) TelegramConfig() (notif.TelegramConfig, error) {
+	ch, err := a.channel(domain.ChannelTelegram)
+	if err != nil {
+		return notif.TelegramConfig{}, err
+	}
+	return a.telegramConfig(ch)
+}
+
+func (a *App) telegramConfig(ch *domain.Channel) (notif.TelegramConfig, error) {
+	cfg := notif.TelegramConfig{
+		BotToken: a.Cfg.TelegramBotToken, ChatID: a.Cfg.TelegramChatID, ParseMode: a.Cfg.TelegramParseMode,
+	}
+	if ch != nil && ch.Config != "" {
+		cfg = notif.TelegramConfig{}
+		if err := a.decodeConfig(ch.Config, &cfg); err != nil {
+			return cfg, fmt.Errorf("telegram channel config: %w", err)
+		}
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = a.Cfg.TelegramAPIURL
+	}
+	return cfg, nil
+}
+
+// ChannelConfig decodes the saved config of the channel of kind into v,
+// decrypting it if needed. It reports false, leaving v untouched, when the
+// channel has no saved config.
+func (a *App) ChannelConfig(kind domain.ChannelKind, v any) (bool, error) {
+	ch, err := a.channel(kind)
+	if err != nil || ch == nil || ch.Config == "" {
+		return false, err
+	}
+	if err := a.decodeConfig(ch.Config, v); err != nil {
+		return false, fmt.Errorf("%s channel config: %w", strings.ToLower(string(kind)), err)
+	}
+	return true, nil
+}
+
+func (a *App) decodeConfig(stored string, v any) error {
+	js := []byte(stored)
+	if secrets.IsSealed(stored) {
+		var err error
+		if js, err = a.keys.Open(stored); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(js, v)
+}
+
+// sealConfig encrypts a JSON channel config for storage, or returns it as is
+// when no master key is configured.
+func (a *App) sealConfig(js []byte) (string, error) {
+	if a.keys == nil {
+		return string(js), nil
+	}
+	return a.keys.Seal(js)
+}
+
+// sealChannels brings every saved channel config in line with the keyring:
+// plaintext configs are encrypted and configs sealed under a previous master
+// key are re-wrapped under the current one. Without a keyring it only checks
+// that no config is encrypted, since those couldn't be read.
+func (a *App) sealChannels() error {
+	var chs []domain.Channel
+	if err := a.DB.Where("config <> ''").Find(&chs).Error; err != nil {
+		return err
+	}
+	var sealed, rewrapped int
+	for _, ch := range chs {
+		stored := ch.Config
+		switch {
+		case a.keys == nil:
+			if secrets.IsSealed(stored) {
+				return fmt.Errorf("%s channel config: %w", strings.ToLower(string(ch.Kind)), secrets.ErrNoKey)
+			}
+			continue
+		case !secrets.IsSealed(stored):
+			v, err := a.keys.Seal([]byte(stored))
+			if err != nil {
+				return err
+			}
+			ch.Config = v
+			sealed++
+		case a.keys.Stale(stored):
+			v, err := a.keys.Rewrap(stored)
+			if err != nil {
+				return fmt.Errorf("%s channel config: %w", strings.ToLower(string(ch.Kind)), err)
+			}
+			ch.Config = v
+			rewrapped++
+		default:
+			continue
+		}
+		if err := a.DB.Model(&domain.Channel{}).Where("id = ?", ch.ID).Update("config", ch.Config).Error; err != nil {
+			return err
+		}
+	}
+	if a.keys == nil && len(chs) > 0 {
+		log.Warn().Msg("channel configs are stored unencrypted; set SECRETS_KEY to encrypt them")
+	}
+	if sealed+rewrapped > 0 {
+		log.Info().Int("encrypted", sealed).Int("rewrapped", rewrapped).Msg("channel configs sealed")
+	}
+	return nil
+}
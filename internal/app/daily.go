@@ -0,0 +1,46 @@
+package app
+
+import (
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
+	"github.com/Secretstar513/crypto-alerts/internal/rules"
+)
+
+var dailyKinds = []domain.AlertKind{domain.KindVolume, domain.KindChange, domain.KindHigh, domain.KindLow}
+
+// evaluateDaily checks the 24h volume, change and high/low alerts of a
+// symbol whose last price moved from prev to cur. Both updates must carry a
+// 24h window. Volume and change alerts fire as their value crosses the
+// threshold; high and low alerts when the price breaks through the high or
+// low that stood before cur, which the notification gives as the threshold.
+func (a *App) evaluateDaily(prev, cur domain.LastPrice) {
+	if prev.Day.High == 0 || cur.Day.High == 0 {
+		return
+	}
+	var alerts []domain.Alert
+	if err := a.DB.Preload("Channels").
+		Where("enabled = ? AND kind IN ? AND symbol = ?", true, dailyKinds, cur.Symbol).
+		Find(&alerts).Error; err != nil {
+		return
+	}
+	for _, al := range alerts {
+		var from, to, line float64
+		switch al.Kind {
+		case domain.KindVolume:
+			from, to, line = prev.Day.QuoteVolume, cur.Day.QuoteVolume, al.Threshold
+		case domain.KindChange:
+			from, to, line = prev.Day.ChangePercent, cur.Day.ChangePercent, al.Threshold
+		case domain.KindHigh:
+			from, to, line = prev.Price, cur.Price, prev.Day.High
+		case domain.KindLow:
+			from, to, line = prev.Price, cur.Price, prev.Day.Low
+		}
+		metrics.RuleEvaluations.WithLabelValues(al.Symbol, ruleKind(al)).Inc()
+		if rules.CrossesLine(from, to, line, line, al.Direction) {
+			metrics.AlertsFired.WithLabelValues(al.Symbol, ruleKind(al), string(al.Severity)).Inc()
+			fired := al
+			fired.Threshold = line
+			a.fire(a.sendCtx, fired, al.Series(), to)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
+	"github.com/Secretstar513/crypto-alerts/internal/notif"
+)
+
+// deliver sends ev through t now, or holds it back when the channel batches
+// alerts into digests or is in quiet hours, whose policy then decides.
+// CRITICAL alerts skip both when the channel allows it.
+func (a *App) deliver(ctx context.Context, t target, ev notif.Event) {
+	if t.ch != nil {
+		s := t.ch.Schedule
+		quiet := !s.Active(ev.Time)
+		switch {
+		case s.CriticalOverride && ev.Severity == string(domain.SeverityCritical):
+		case quiet && s.QuietPolicy == domain.QuietDrop:
+			metrics.Notifications.WithLabelValues(t.n.Name(), "dropped").Inc()
+			log.Info().Str("notifier", t.n.Name()).Str("symbol", ev.Symbol).Msg("alert dropped during quiet hours")
+			return
+		case quiet || t.ch.Digest != domain.DigestOff:
+			if err := a.queue(t.ch.ID, ev); err != nil {
+				log.Error().Err(err).Str("notifier", t.n.Name()).Msg("queue alert failed")
+				return
+			}
+			metrics.Notifications.WithLabelValues(t.n.Name(), "queued").Inc()
+			return
+		}
+	}
+	err := measure(t.n, func() error { return t.n.Notify(ctx, ev) })
+	if err != nil && !errors.Is(err, notif.ErrNotConfigured) {
+		log.Error().Err(err).Str("notifier", t.n.Name()).Msg("notify failed")
+	}
+}
+
+// measure runs fn, which hands a message to n, and records its outcome and
+// duration.
+func measure(n notif.Notifier, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	metrics.NotifyDuration.WithLabelValues(n.Name()).Observe(time.Since(start).Seconds())
+	outcome := "sent"
+	switch {
+	case errors.Is(err, notif.ErrNotConfigured):
+		outcome = "not_configured"
+	case err != nil:
+		outcome = "failed"
+	}
+	metrics.Notifications.WithLabelValues(n.Name(), outcome).Inc()
+	return err
+}
+
+func (a *App) queue(channelID string, ev notif.Event) error {
+	return a.DB.Create(&domain.PendingEvent{
+		ID:        nuid.Next(),
+		ChannelID: channelID,
+		Symbol:    ev.Symbol,
+		Price:     ev.Price,
+		Threshold: ev.Threshold,
+		Direction: domain.Direction(ev.Direction),
+		Condition: ev.Condition,
+		Severity:  domain.Severity(ev.Severity),
+		FiredAt:   ev.Time,
+	}).Error
+}
+
+// observe feeds a price into the daily summaries of the channels that want one.
+func (a *App) observe(symbol string, p float64) {
+	a.mu.RLock()
+	var ids []string
+	for _, ch := range a.channels {
+		if ch.DailySummary {
+			ids = append(ids, ch.ID)
+		}
+	}
+	a.mu.RUnlock()
+	if len(ids) > 0 {
+		a.summaries.observe(ids, symbol, p)
+	}
+}
+
+// runScheduler periodically sends what each channel has been holding back:
+// alerts queued during quiet hours, hourly/daily digests and daily summaries.
+func (a *App) runScheduler(ctx context.Context) {
+	tk := time.NewTicker(30 * time.Second)
+	defer tk.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			a.flushQueued(a.sendCtx, a.now())
+		}
+	}
+}
+
+func (a *App) flushQueued(ctx context.Context, now time.Time) {
+	chs, err := a.ListChannels()
+	if err != nil {
+		return
+	}
+	a.mu.RLock()
+	notifs := a.Notifiers
+	a.mu.RUnlock()
+
+	for _, ch := range chs {
+		n := notifierFor(notifs, ch.Kind)
+		if n == nil || !n.Enabled() || !ch.Schedule.Active(now) {
+			continue
+		}
+		if ch.DailySummary && ch.SummarySentAt.IsZero() {
+			// Start the first period now rather than sending an empty summary.
+			a.DB.Model(&ch).Update("summary_sent_at", now)
+			ch.SummarySentAt = now
+		}
+
+		var d notif.Digest
+		updates := map[string]any{}
+
+		digestDue := ch.Digest == domain.DigestOff || ch.LastDigest(now).After(ch.DigestSentAt)
+		var ids []string
+		if digestDue {
+			var pending []domain.PendingEvent
+			if err := a.DB.Where("channel_id = ?", ch.ID).Order("fired_at asc").Find(&pending).Error; err != nil {
+				continue
+			}
+			for _, p := range pending {
+				ids = append(ids, p.ID)
+				d.Events = append(d.Events, notif.Event{
+					Symbol: p.Symbol, Price: p.Price, Threshold: p.Threshold, Direction: string(p.Direction),
+					Condition: p.Condition, Severity: string(p.Severity), Time: p.FiredAt,
+				})
+			}
+			if ch.Digest != domain.DigestOff {
+				updates["digest_sent_at"] = now
+			}
+		}
+		var period map[string]*ohlc
+		if ch.DailySummary && ch.LastSummary(now).After(ch.SummarySentAt) {
+			period = a.summaries.take(ch.ID)
+			d.Summary = summaryLines(period)
+			updates["summary_sent_at"] = now
+		}
+
+		switch {
+		case len(d.Events) == 0 && len(d.Summary) == 0:
+		case len(d.Events) == 0:
+			d.Title = "Daily summary"
+		case ch.Digest == domain.DigestHourly:
+			d.Title = fmt.Sprintf("Hourly digest: %d alert(s)", len(d.Events))
+		case ch.Digest == domain.DigestDaily:
+			d.Title = fmt.Sprintf("Daily digest: %d alert(s)", len(d.Events))
+		default:
+			d.Title = fmt.Sprintf("%d alert(s) held during quiet hours", len(d.Events))
+		}
+		if d.Title != "" {
+			err := measure(n, func() error { return notif.SendDigest(ctx, n, d) })
+			if err != nil && !errors.Is(err, notif.ErrNotConfigured) {
+				log.Error().Err(err).Str("notifier", n.Name()).Msg("digest failed")
+				// Retry on the next tick with the same period.
+				a.summaries.restore(ch.ID, period)
+				continue
+			}
+		}
+		if len(ids) > 0 {
+			a.DB.Delete(&domain.PendingEvent{}, "id IN ?", ids)
+		}
+		if len(updates) > 0 {
+			a.DB.Model(&ch).Updates(updates)
+		}
+	}
+}
+
+func notifierFor(notifs []notif.Notifier, kind domain.ChannelKind) notif.Notifier {
+	for _, n := range notifs {
+		if domain.ChannelKind(strings.ToUpper(n.Name())) == kind {
+			return n
+		}
+	}
+	return nil
+}
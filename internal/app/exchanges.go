@@ -0,0 +1,88 @@
+package app
+
+import (
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"github.com/Secretstar513/crypto-alerts/internal/config"
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/price"
+)
+
+// feedKey names one exchange's price stream of a symbol.
+type feedKey struct {
+	exchange, symbol string
+}
+
+// alertFeeds returns the streams whose prices al depends on.
+func (a *App) alertFeeds(al domain.Alert) []feedKey {
+	switch al.Kind {
+	case domain.KindArbitrage:
+		return []feedKey{{al.Exchange, al.Symbol}, {al.PairExchange, al.Symbol}}
+	case domain.KindRatio, domain.KindSpread:
+		return []feedKey{{domain.ExchangeBinance, al.Symbol}, {domain.ExchangeBinance, al.PairSymbol}}
+	}
+	if al.Expr == "" {
+		return []feedKey{{domain.ExchangeBinance, al.Symbol}}
+	}
+	e, err := a.exprs.parse(al)
+	if err != nil {
+		return []feedKey{{domain.ExchangeBinance, al.Symbol}}
+	}
+	out := make([]feedKey, len(e.Symbols()))
+	for i, sym := range e.Symbols() {
+		out[i] = feedKey{domain.ExchangeBinance, sym}
+	}
+	return out
+}
+
+// secondaryRouters returns a router for every exchange besides Binance. A
+// replay stands in for Binance alone, so there are none while replaying.
+func secondaryRouters(cfg *config.Config) map[string]*price.Router {
+	if cfg.PriceReplayFile != "" {
+		return nil
+	}
+	coinbase := &price.CoinbaseFeed{
+		WSURL:         cfg.CoinbaseWSURL,
+		RESTURL:       cfg.CoinbaseRESTURL,
+		PollInterval:  cfg.PollInterval,
+		RetryDelay:    cfg.ReconnectDelay,
+		MaxRetryDelay: cfg.ReconnectMaxDelay,
+		HTTP:          http.DefaultClient,
+	}
+	return map[string]*price.Router{
+		price.ExchangeCoinbase: price.NewRouter(price.ExchangeCoinbase, coinbase),
+	}
+}
+
+// router returns exchange's router, or nil when it has no feed.
+func (a *App) router(exchange string) *price.Router {
+	if exchange == domain.ExchangeBinance {
+		return a.Router
+	}
+	return a.routers[exchange]
+}
+
+// migrateLastPrices rebuilds a last_prices table from before prices were
+// kept per exchange, whose primary key is the symbol alone; its rows were
+// all Binance prices.
+func migrateLastPrices(d *gorm.DB) error {
+	m := d.Migrator()
+	if !m.HasTable(&domain.LastPrice{}) || m.HasColumn(&domain.LastPrice{}, "Exchange") {
+		return nil
+	}
+	return d.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().RenameTable("last_prices", "last_prices_v1"); err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateTable(&domain.LastPrice{}); err != nil {
+			return err
+		}
+		if err := tx.Exec("INSERT INTO last_prices (exchange, symbol, price, updated_at) SELECT ?, symbol, price, updated_at FROM last_prices_v1",
+			domain.ExchangeBinance).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable("last_prices_v1")
+	})
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/rules"
+)
+
+// exprBook caches the parsed conditions of expression alerts so updates and
+// watchdog ticks don't load and parse them again. It is dropped whenever
+// alerts change.
+type exprBook struct {
+	mu sync.Mutex
+	// parsed maps an alert ID to its condition, checked against the source
+	// in case the row was read before an edit.
+	parsed map[string]parsedExpr
+	// live holds the enabled expression alerts; nil until loaded.
+	live []liveExpr
+}
+
+type parsedExpr struct {
+	src string
+	e   *rules.Expr
+	err error
+}
+
+// liveExpr is an enabled expression alert with its parsed condition.
+type liveExpr struct {
+	al domain.Alert
+	e  *rules.Expr
+}
+
+func newExprBook() *exprBook {
+	return &exprBook{parsed: map[string]parsedExpr{}}
+}
+
+// parse returns al's parsed condition.
+func (b *exprBook) parse(al domain.Alert) (*rules.Expr, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.parseLocked(al)
+}
+
+func (b *exprBook) parseLocked(al domain.Alert) (*rules.Expr, error) {
+	if p, ok := b.parsed[al.ID]; ok && p.src == al.Expr {
+		return p.e, p.err
+	}
+	e, err := rules.Parse(al.Expr)
+	b.parsed[al.ID] = parsedExpr{src: al.Expr, e: e, err: err}
+	return e, err
+}
+
+// enabled returns the enabled expression alerts, reading them with load the
+// first time after a reset. Alerts whose condition no longer parses are
+// logged once and left out.
+func (b *exprBook) enabled(load func() ([]domain.Alert, error)) ([]liveExpr, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.live != nil {
+		return b.live, nil
+	}
+	alerts, err := load()
+	if err != nil {
+		return nil, err
+	}
+	live := make([]liveExpr, 0, len(alerts))
+	for _, al := range alerts {
+		e, err := b.parseLocked(al)
+		if err != nil {
+			log.Warn().Err(err).Str("alert", al.ID).Msg("skipping unparsable condition")
+			continue
+		}
+		live = append(live, liveExpr{al: al, e: e})
+	}
+	b.live = live
+	return live, nil
+}
+
+// reset drops everything cached, so the next update reads the alerts again.
+func (b *exprBook) reset() {
+	b.mu.Lock()
+	b.parsed = map[string]parsedExpr{}
+	b.live = nil
+	b.mu.Unlock()
+}
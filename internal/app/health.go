@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/notif"
+	"github.com/Secretstar513/crypto-alerts/internal/price"
+)
+
+// FeedStatus is a symbol stream's state together with how many enabled
+// alerts watch it. Stale is only ever set for watched symbols.
+type FeedStatus struct {
+	price.StreamStatus
+	Alerts int
+	Stale  bool
+}
+
+// FeedStatus reports every symbol the engine has subscribed to, Binance
+// first, then the other exchanges in domain.Exchanges order.
+func (a *App) FeedStatus() ([]FeedStatus, error) {
+	var alerts []domain.Alert
+	if err := a.DB.Select("id", "kind", "symbol", "pair_symbol", "exchange", "pair_exchange", "expr").
+		Where("enabled = ?", true).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	watched := map[feedKey]int{}
+	for _, al := range alerts {
+		for _, k := range a.alertFeeds(al) {
+			watched[k]++
+		}
+	}
+
+	now := time.Now()
+	var out []FeedStatus
+	for _, ex := range domain.Exchanges {
+		r := a.router(ex)
+		if r == nil {
+			continue
+		}
+		for _, st := range r.Status() {
+			last := st.LastUpdate
+			if last.IsZero() {
+				last = st.Started
+			}
+			n := watched[feedKey{ex, st.Symbol}]
+			out = append(out, FeedStatus{
+				StreamStatus: st,
+				Alerts:       n,
+				Stale:        n > 0 && now.Sub(last) > a.Cfg.StaleAfter,
+			})
+		}
+	}
+	return out, nil
+}
+
+// Name labels the feed in notices: the symbol, plus the exchange unless it
+// is Binance.
+func (f FeedStatus) Name() string {
+	if f.Exchange == domain.ExchangeBinance {
+		return f.Symbol
+	}
+	return f.Symbol + " on " + f.Exchange
+}
+
+// runWatchdog tells the channels when a watched symbol's feed goes stale and
+// again when it recovers.
+func (a *App) runWatchdog(ctx context.Context) {
+	tk := time.NewTicker(a.Cfg.EngineTick)
+	defer tk.Stop()
+	stale := map[feedKey]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+		feeds, err := a.FeedStatus()
+		if err != nil {
+			continue
+		}
+		for _, f := range feeds {
+			k := feedKey{f.Exchange, f.Symbol}
+			switch {
+			case f.Stale && !stale[k]:
+				stale[k] = true
+				a.notifySystem(a.sendCtx, staleDigest(f, a.Cfg.StaleAfter))
+			case !f.Stale && stale[k]:
+				delete(stale, k)
+				if f.Alerts > 0 {
+					a.notifySystem(a.sendCtx, notif.Digest{
+						Title:   "Feed recovered: " + f.Name(),
+						Summary: []string{fmt.Sprintf("Price %.8f via %s", f.LastPrice, f.Transport)},
+					})
+				}
+			}
+		}
+	}
+}
+
+func staleDigest(f FeedStatus, after time.Duration) notif.Digest {
+	last := "never"
+	if !f.LastUpdate.IsZero() {
+		last = f.LastUpdate.UTC().Format("2006-01-02 15:04:05Z")
+	}
+	lines := []string{
+		fmt.Sprintf("No price update for over %s (last: %s)", after, last),
+		fmt.Sprintf("Feed state: %s since %s", f.State, f.Since.UTC().Format("15:04:05Z")),
+		fmt.Sprintf("%d alert(s) can't fire until it recovers", f.Alerts),
+	}
+	if f.LastError != "" {
+		lines = append(lines, "Last error: "+f.LastError)
+	}
+	return notif.Digest{Title: "Stale feed: " + f.Name(), Summary: lines}
+}
+
+// notifySystem sends d to every enabled notifier at once, as a WARNING: it
+// skips channels whose minimum severity is higher but ignores schedules and
+// digests, since a silent feed is exactly what they'd hide.
+func (a *App) notifySystem(ctx context.Context, d notif.Digest) {
+	log.Warn().Strs("lines", d.Summary).Msg(d.Title)
+	a.mu.RLock()
+	var targets []notif.Notifier
+	for _, n := range a.Notifiers {
+		if ch, ok := a.channels[n.Name()]; ok && ch.MinSeverity.Rank() > domain.SeverityWarning.Rank() {
+			continue
+		}
+		if n.Enabled() {
+			targets = append(targets, n)
+		}
+	}
+	a.mu.RUnlock()
+	for _, n := range targets {
+		err := measure(n, func() error { return notif.SendDigest(ctx, n, d) })
+		if err != nil && !errors.Is(err, notif.ErrNotConfigured) {
+			log.Error().Err(err).Str("notifier", n.Name()).Msg("system notification failed")
+		}
+	}
+}
+
+// Ready reports why the app can't serve yet, or nil: the database must answer,
+// the engine loop must have run within a few ticks, and when any alert is
+// enabled at least one watched feed must be delivering prices.
+func (a *App) Ready(ctx context.Context) error {
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+
+	beat := a.engineBeat.Load()
+	if beat == 0 {
+		return errors.New("engine: not started")
+	}
+	if since := time.Since(time.Unix(0, beat)); since > 3*a.Cfg.EngineTick {
+		return fmt.Errorf("engine: last pass %s ago", since.Round(time.Millisecond))
+	}
+
+	feeds, err := a.FeedStatus()
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	var live int
+	for _, f := range feeds {
+		if f.Alerts > 0 && !f.Stale && !f.LastUpdate.IsZero() {
+			live++
+		}
+	}
+	var enabled int64
+	if err := a.DB.Model(&domain.Alert{}).Where("enabled = ?", true).Count(&enabled).Error; err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	if enabled > 0 && live == 0 {
+		return fmt.Errorf("feeds: no watched symbol is receiving prices (%d enabled alert(s))", enabled)
+	}
+	return nil
+}
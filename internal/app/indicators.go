@@ -0,0 +1,239 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/history"
+	"github.com/Secretstar513/crypto-alerts/internal/indicators"
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
+	"github.com/Secretstar513/crypto-alerts/internal/rules"
+)
+
+var indicatorKinds = []domain.AlertKind{domain.KindSMA, domain.KindEMA, domain.KindEMACross, domain.KindRSI}
+
+// reading is where an indicator alert stands: it fires when value crosses
+// line. The line is the moving average for SMA and EMA alerts, the slow EMA
+// for crossovers, and the alert's level for RSI.
+type reading struct {
+	value, line float64
+}
+
+// study computes the readings of an indicator alert's series from the
+// closes of its candles.
+type study struct {
+	kind domain.AlertKind
+	fast indicators.Indicator // the value; nil when it is the price itself
+	slow indicators.Indicator // the line; nil for RSI
+}
+
+func newStudy(al domain.Alert) *study {
+	s := &study{kind: al.Kind}
+	switch al.Kind {
+	case domain.KindSMA:
+		s.slow = indicators.NewSMA(al.Period)
+	case domain.KindEMA:
+		s.slow = indicators.NewEMA(al.Period)
+	case domain.KindEMACross:
+		s.fast, s.slow = indicators.NewEMA(al.Period), indicators.NewEMA(al.SlowPeriod)
+	case domain.KindRSI:
+		s.fast = indicators.NewRSI(al.Period)
+	}
+	return s
+}
+
+// warmup is how many closed candles a study reads before its first reading:
+// one window for an SMA, a few more for EMA and RSI smoothing to settle.
+func warmup(al domain.Alert) int {
+	if al.Kind == domain.KindSMA {
+		return al.Period
+	}
+	return 4 * max(al.Period, al.SlowPeriod)
+}
+
+func (s *study) push(close float64) {
+	if s.fast != nil {
+		s.fast.Push(close)
+	}
+	if s.slow != nil {
+		s.slow.Push(close)
+	}
+}
+
+// peek returns the reading if the forming candle closed at price; an RSI
+// reading's line is left for the alert to set.
+func (s *study) peek(price float64) (r reading, ok bool) {
+	r.value, ok = price, true
+	if s.fast != nil {
+		if r.value, ok = s.fast.Peek(price); !ok {
+			return r, false
+		}
+	}
+	if s.slow != nil {
+		r.line, ok = s.slow.Peek(price)
+	}
+	return r, ok
+}
+
+// studyBook holds the live study of every indicator series, with the
+// candle it is forming and the last reading.
+type studyBook struct {
+	mu     sync.Mutex
+	series map[string]*liveStudy
+}
+
+type liveStudy struct {
+	*study
+	bar     time.Time // open time of the forming candle
+	last    float64   // latest price in it
+	prev    reading
+	hasPrev bool
+}
+
+func newStudyBook() *studyBook {
+	return &studyBook{series: map[string]*liveStudy{}}
+}
+
+// prune drops the studies of series that aren't in keep.
+func (b *studyBook) prune(keep map[string]bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for series := range b.series {
+		if !keep[series] {
+			delete(b.series, series)
+		}
+	}
+}
+
+// pruneStudies drops the studies of series no enabled indicator alert uses
+// any more. A series that comes back warms up afresh from the candles.
+func (a *App) pruneStudies() {
+	var alerts []domain.Alert
+	if err := a.DB.Where("enabled = ? AND kind IN ?", true, indicatorKinds).Find(&alerts).Error; err != nil {
+		log.Warn().Err(err).Msg("pruning indicator studies")
+		return
+	}
+	keep := make(map[string]bool, len(alerts))
+	for _, al := range alerts {
+		keep[al.Series()] = true
+	}
+	a.studies.prune(keep)
+}
+
+// step moves al's series to price at time at, closing the forming candle at
+// its last price when at falls in a later one. A new series first reads its
+// warm-up from the stored candles. ok is false while the indicators lack
+// candles and for the first reading.
+func (a *App) step(al domain.Alert, price float64, at time.Time) (prev, cur reading, ok bool) {
+	iv, err := history.ParseInterval(al.Interval)
+	if err != nil {
+		return prev, cur, false
+	}
+	bar := at.UTC().Truncate(iv.Duration)
+
+	b := a.studies
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.series[al.Series()]
+	switch {
+	case s == nil:
+		cs, err := a.History.Candles(al.Symbol, iv, time.Time{}, bar, warmup(al))
+		if err != nil {
+			log.Warn().Err(err).Str("series", al.Series()).Msg("indicator warm-up failed")
+			return prev, cur, false
+		}
+		s = &liveStudy{study: newStudy(al), bar: bar}
+		for _, c := range cs {
+			s.push(c.Close)
+		}
+		b.series[al.Series()] = s
+	case bar.After(s.bar):
+		s.push(s.last)
+		s.bar = bar
+	case bar.Before(s.bar):
+		return prev, cur, false // late update for a closed candle
+	}
+	s.last = price
+
+	cur, ready := s.peek(price)
+	if !ready {
+		s.hasPrev = false
+		return prev, cur, false
+	}
+	prev, ok = s.prev, s.hasPrev
+	s.prev, s.hasPrev = cur, true
+	return prev, cur, ok
+}
+
+// evaluateIndicators feeds an update of symbol into its indicator alerts,
+// firing those whose value crosses their line. The notification carries the
+// value as the price and the line as the threshold.
+func (a *App) evaluateIndicators(symbol string, priceVal float64, at time.Time) {
+	var alerts []domain.Alert
+	if err := a.DB.Preload("Channels").
+		Where("enabled = ? AND kind IN ? AND symbol = ?", true, indicatorKinds, symbol).
+		Find(&alerts).Error; err != nil || len(alerts) == 0 {
+		return
+	}
+
+	// Alerts on the same series share one reading per update.
+	type result struct {
+		prev, cur reading
+		ok        bool
+	}
+	results := map[string]result{}
+	for _, al := range alerts {
+		r, seen := results[al.Series()]
+		if !seen {
+			r.prev, r.cur, r.ok = a.step(al, priceVal, at)
+			results[al.Series()] = r
+		}
+		if !r.ok {
+			continue
+		}
+		prev, cur := r.prev, r.cur
+		if al.Kind == domain.KindRSI {
+			prev.line, cur.line = al.Threshold, al.Threshold
+		}
+		metrics.RuleEvaluations.WithLabelValues(al.Symbol, ruleKind(al)).Inc()
+		if rules.CrossesLine(prev.value, cur.value, prev.line, cur.line, al.Direction) {
+			metrics.AlertsFired.WithLabelValues(al.Symbol, ruleKind(al), string(al.Severity)).Inc()
+			fired := al
+			fired.Threshold = cur.line
+			a.fire(a.sendCtx, fired, al.Series(), cur.value)
+		}
+	}
+}
+
+// IndicatorHistory returns up to n readings of an indicator alert, one per
+// stored candle, oldest first, as plotted against the alert's threshold:
+// the RSI itself, or the value's distance above its line.
+func (a *App) IndicatorHistory(al domain.Alert, n int) ([]float64, error) {
+	iv, err := history.ParseInterval(al.Interval)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := a.History.Candles(al.Symbol, iv, time.Time{}, time.Time{}, n+warmup(al))
+	if err != nil {
+		return nil, err
+	}
+	s := newStudy(al)
+	var out []float64
+	for _, c := range cs {
+		if r, ok := s.peek(c.Close); ok {
+			if al.Kind == domain.KindRSI {
+				out = append(out, r.value)
+			} else {
+				out = append(out, r.value-r.line)
+			}
+		}
+		s.push(c.Close)
+	}
+	if len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return out, nil
+}
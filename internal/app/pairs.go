@@ -0,0 +1,98 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
+	"github.com/Secretstar513/crypto-alerts/internal/rules"
+)
+
+// pairBook holds the state behind ratio, spread and arbitrage alerts: the
+// latest update of every leg and the last value of every derived series.
+type pairBook struct {
+	mu     sync.Mutex
+	legs   map[feedKey]legPrice
+	series map[string]float64
+}
+
+type legPrice struct {
+	price float64
+	at    time.Time
+}
+
+func newPairBook() *pairBook {
+	return &pairBook{legs: map[feedKey]legPrice{}, series: map[string]float64{}}
+}
+
+// update records a leg's price and returns the new value of al's series
+// together with its previous one. ok is false while either leg has no price,
+// or their latest updates are more than maxSkew apart, so the value is never
+// computed from prices seen at different times; hasPrev is false for the
+// first aligned value.
+func (b *pairBook) update(al domain.Alert, maxSkew time.Duration) (prev, cur float64, hasPrev, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ex, sym, pairEx, pairSym := al.Legs()
+	l, okL := b.legs[feedKey{ex, sym}]
+	r, okR := b.legs[feedKey{pairEx, pairSym}]
+	if !okL || !okR || r.price == 0 {
+		return 0, 0, false, false
+	}
+	if skew := l.at.Sub(r.at); skew > maxSkew || -skew > maxSkew {
+		return 0, 0, false, false
+	}
+	cur = al.Derive(l.price, r.price)
+	prev, hasPrev = b.series[al.Series()]
+	b.series[al.Series()] = cur
+	return prev, cur, hasPrev, true
+}
+
+func (b *pairBook) record(leg feedKey, p float64, at time.Time) {
+	b.mu.Lock()
+	b.legs[leg] = legPrice{price: p, at: at}
+	b.mu.Unlock()
+}
+
+// evaluatePairs feeds an update of symbol on exchange at time at into the
+// ratio, spread and arbitrage alerts that use it, firing those whose derived
+// series crosses its threshold.
+func (a *App) evaluatePairs(exchange, symbol string, priceVal float64, at time.Time) {
+	uses := a.DB.Where("kind = ? AND symbol = ? AND (exchange = ? OR pair_exchange = ?)",
+		domain.KindArbitrage, symbol, exchange, exchange)
+	if exchange == domain.ExchangeBinance {
+		uses = uses.Or("kind IN ? AND (symbol = ? OR pair_symbol = ?)",
+			[]domain.AlertKind{domain.KindRatio, domain.KindSpread}, symbol, symbol)
+	}
+	var alerts []domain.Alert
+	if err := a.DB.Preload("Channels").Where("enabled = ?", true).Where(uses).
+		Find(&alerts).Error; err != nil || len(alerts) == 0 {
+		return
+	}
+	a.pairs.record(feedKey{exchange, symbol}, priceVal, at)
+
+	// Alerts on the same series share one value per update.
+	type step struct {
+		prev, cur   float64
+		hasPrev, ok bool
+	}
+	steps := map[string]step{}
+	for _, al := range alerts {
+		s, seen := steps[al.Series()]
+		if !seen {
+			s.prev, s.cur, s.hasPrev, s.ok = a.pairs.update(al, a.Cfg.PairMaxSkew)
+			steps[al.Series()] = s
+		}
+		if !s.ok || !s.hasPrev {
+			continue
+		}
+		metrics.RuleEvaluations.WithLabelValues(al.Symbol, ruleKind(al)).Inc()
+		// A spread or gap can be exactly 0, which Crosses would take for no
+		// previous value; hasPrev already says whether there is one.
+		if rules.CrossesLine(s.prev, s.cur, al.Threshold, al.Threshold, al.Direction) {
+			metrics.AlertsFired.WithLabelValues(al.Symbol, ruleKind(al), string(al.Severity)).Inc()
+			a.fire(a.sendCtx, al, al.Series(), s.cur)
+		}
+	}
+}
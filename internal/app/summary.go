@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type ohlc struct {
+	Open, High, Low, Close float64
+}
+
+// summaryBook accumulates open/high/low/close per symbol for each channel
+// that wants a daily summary, from the prices the engine sees.
+type summaryBook struct {
+	mu        sync.Mutex
+	byChannel map[string]map[string]*ohlc
+}
+
+func newSummaryBook() *summaryBook {
+	return &summaryBook{byChannel: map[string]map[string]*ohlc{}}
+}
+
+func (b *summaryBook) observe(channelIDs []string, symbol string, p float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, id := range channelIDs {
+		syms := b.byChannel[id]
+		if syms == nil {
+			syms = map[string]*ohlc{}
+			b.byChannel[id] = syms
+		}
+		c := syms[symbol]
+		if c == nil {
+			syms[symbol] = &ohlc{Open: p, High: p, Low: p, Close: p}
+			continue
+		}
+		c.High = max(c.High, p)
+		c.Low = min(c.Low, p)
+		c.Close = p
+	}
+}
+
+// take returns the period accumulated for channelID and starts a new one.
+func (b *summaryBook) take(channelID string) map[string]*ohlc {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	syms := b.byChannel[channelID]
+	delete(b.byChannel, channelID)
+	return syms
+}
+
+// restore puts back a period taken for channelID whose summary couldn't be
+// sent, merging it with the prices seen since as the earlier part.
+func (b *summaryBook) restore(channelID string, syms map[string]*ohlc) {
+	if len(syms) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := b.byChannel[channelID]
+	if cur == nil {
+		b.byChannel[channelID] = syms
+		return
+	}
+	for sym, old := range syms {
+		c := cur[sym]
+		if c == nil {
+			cur[sym] = old
+			continue
+		}
+		c.Open = old.Open
+		c.High = max(c.High, old.High)
+		c.Low = min(c.Low, old.Low)
+	}
+}
+
+// summaryLines formats a period as one line per symbol, sorted by symbol.
+func summaryLines(syms map[string]*ohlc) []string {
+	out := make([]string, 0, len(syms))
+	for sym, c := range syms {
+		chg := 0.0
+		if c.Open != 0 {
+			chg = (c.Close - c.Open) / c.Open * 100
+		}
+		out = append(out, fmt.Sprintf("%s O %.8g H %.8g L %.8g C %.8g (%+.2f%%)", sym, c.Open, c.High, c.Low, c.Close, chg))
+	}
+	sort.Strings(out)
+	return out
+}
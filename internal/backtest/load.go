@@ -0,0 +1,195 @@
+// Package backtest replays historical prices through the alert rules to show
+// when alerts would have fired.
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tick is one price observation.
+type Tick struct {
+	Time  time.Time
+	Price float64
+}
+
+type candle struct {
+	open, close  time.Time
+	o, h, l, c   float64
+	hasCloseTime bool
+}
+
+// LoadFile reads ticks from path. Files ending in .json are parsed as Binance
+// kline JSON (the /api/v3/klines response); anything else as CSV.
+func LoadFile(path string) ([]Tick, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return LoadKlinesJSON(f)
+	}
+	return LoadCSV(f)
+}
+
+// LoadCSV reads either ticks (time,price) or candles
+// (open_time,open,high,low,close[,volume,close_time,...], the Binance kline
+// CSV layout). Times may be RFC3339 or unix seconds, milliseconds or
+// microseconds. A header row is skipped.
+func LoadCSV(r io.Reader) ([]Tick, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var ticks []Tick
+	var candles []candle
+	line := 0
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+		if len(rec) < 2 {
+			continue
+		}
+		t, err := parseTime(rec[0])
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(rec) < 5 {
+			p, err := strconv.ParseFloat(rec[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: price: %w", line, err)
+			}
+			ticks = append(ticks, Tick{Time: t, Price: p})
+			continue
+		}
+		c, err := parseCandle(t, rec[1:5], rec[5:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		candles = append(candles, c)
+	}
+	return merge(ticks, candles), nil
+}
+
+// LoadKlinesJSON reads the array-of-arrays kline format returned by the
+// Binance REST API.
+func LoadKlinesJSON(r io.Reader) ([]Tick, error) {
+	var rows [][]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, err
+	}
+	var candles []candle
+	for i, row := range rows {
+		if len(row) < 5 {
+			return nil, fmt.Errorf("kline %d: want at least 5 fields, got %d", i, len(row))
+		}
+		fields := make([]string, len(row))
+		for j, raw := range row {
+			var s string
+			if json.Unmarshal(raw, &s) != nil {
+				s = string(raw)
+			}
+			fields[j] = s
+		}
+		t, err := parseTime(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("kline %d: %w", i, err)
+		}
+		c, err := parseCandle(t, fields[1:5], fields[5:])
+		if err != nil {
+			return nil, fmt.Errorf("kline %d: %w", i, err)
+		}
+		candles = append(candles, c)
+	}
+	return merge(nil, candles), nil
+}
+
+func parseCandle(open time.Time, ohlc, rest []string) (candle, error) {
+	var v [4]float64
+	for i, s := range ohlc {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return candle{}, fmt.Errorf("ohlc: %w", err)
+		}
+		v[i] = f
+	}
+	c := candle{open: open, o: v[0], h: v[1], l: v[2], c: v[3]}
+	// Binance layout: open, high, low, close, volume, close_time.
+	if len(rest) >= 2 {
+		if ct, err := parseTime(rest[1]); err == nil {
+			c.close, c.hasCloseTime = ct, true
+		}
+	}
+	return c, nil
+}
+
+// merge expands candles into a price path and sorts everything by time. A
+// candle becomes open → low → high → close when it closed up and
+// open → high → low → close when it closed down, so crossings inside the bar
+// are seen in a plausible order.
+func merge(ticks []Tick, candles []candle) []Tick {
+	sort.Slice(candles, func(i, j int) bool { return candles[i].open.Before(candles[j].open) })
+	for i, c := range candles {
+		end := c.close
+		if !c.hasCloseTime {
+			switch {
+			case i+1 < len(candles):
+				end = candles[i+1].open.Add(-time.Millisecond)
+			case i > 0:
+				end = c.open.Add(candles[i].open.Sub(candles[i-1].open) - time.Millisecond)
+			default:
+				end = c.open.Add(time.Minute - time.Millisecond)
+			}
+		}
+		step := end.Sub(c.open) / 3
+		mid1, mid2 := c.l, c.h
+		if c.c < c.o {
+			mid1, mid2 = c.h, c.l
+		}
+		ticks = append(ticks,
+			Tick{c.open, c.o},
+			Tick{c.open.Add(step), mid1},
+			Tick{c.open.Add(2 * step), mid2},
+			Tick{end, c.c},
+		)
+	}
+	sort.SliceStable(ticks, func(i, j int) bool { return ticks[i].Time.Before(ticks[j].Time) })
+	return ticks
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n > 1e15:
+			return time.UnixMicro(n).UTC(), nil
+		case n > 1e12:
+			return time.UnixMilli(n).UTC(), nil
+		default:
+			return time.Unix(n, 0).UTC(), nil
+		}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time %q: want RFC3339 or unix seconds/ms/us", s)
+	}
+	return t, nil
+}
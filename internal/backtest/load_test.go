@@ -0,0 +1,114 @@
+package backtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func prices(ticks []Tick) []float64 {
+	out := make([]float64, len(ticks))
+	for i, tk := range ticks {
+		out[i] = tk.Price
+	}
+	return out
+}
+
+func equalPrices(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLoadCSVTicks(t *testing.T) {
+	in := "time,price\n" +
+		"2026-10-19T10:00:02Z,101\n" +
+		"1760868000,100\n" + // unix seconds: 2025-10-19T10:00:00Z
+		"1760868001000,100.5\n" // unix ms, a second later
+	ticks, err := LoadCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prices(ticks), []float64{100, 100.5, 101}; !equalPrices(got, want) {
+		t.Fatalf("prices = %v, want %v sorted by time", got, want)
+	}
+	if !ticks[1].Time.Equal(time.Unix(1760868001, 0)) {
+		t.Fatalf("ms timestamp parsed as %s", ticks[1].Time)
+	}
+
+	for _, bad := range []string{
+		"time,price\n2026-10-19T10:00:00Z,abc\n",
+		"2026-10-19T10:00:00Z,1\nyesterday,2\n",
+	} {
+		if _, err := LoadCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadCSV(%q) accepted bad input", bad)
+		}
+	}
+}
+
+func TestLoadCandlePaths(t *testing.T) {
+	// An up bar replays open → low → high → close, a down bar open → high →
+	// low → close; a bar without close_time ends just before the next one.
+	csv := "open_time,open,high,low,close,volume,close_time\n" +
+		"1760868000000,100,110,90,105,1.5,1760868059999\n" +
+		"1760868060000,105,108,95,97\n"
+	ticks, err := LoadCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{100, 90, 110, 105, 105, 108, 95, 97}
+	if got := prices(ticks); !equalPrices(got, want) {
+		t.Fatalf("csv path = %v, want %v", got, want)
+	}
+	if end := ticks[3].Time; !end.Equal(time.UnixMilli(1760868059999)) {
+		t.Fatalf("first bar closes at %s, want its close_time", end)
+	}
+	if end := ticks[7].Time; !end.Equal(time.UnixMilli(1760868119999)) {
+		t.Fatalf("last bar closes at %s, want one bar length after its open", end)
+	}
+
+	js := `[[1760868000000,"100","110","90","105","1.5",1760868059999],
+	        [1760868060000,"105","108","95","97","2",1760868119999]]`
+	fromJSON, err := LoadKlinesJSON(strings.NewReader(js))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prices(fromJSON); !equalPrices(got, want) {
+		t.Fatalf("json path = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{`{}`, `[[1760868000000,"100"]]`, `[[1760868000000,"x","1","1","1"]]`} {
+		if _, err := LoadKlinesJSON(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadKlinesJSON(%s) accepted bad input", bad)
+		}
+	}
+}
+
+func TestLoadFilePicksFormatByExtension(t *testing.T) {
+	dir := t.TempDir()
+	js := filepath.Join(dir, "klines.JSON")
+	if err := os.WriteFile(js, []byte(`[[1760868000000,"1","3","1","2"]]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	csv := filepath.Join(dir, "ticks.txt")
+	if err := os.WriteFile(csv, []byte("1760868000,1\n1760868001,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ticks, err := LoadFile(js); err != nil || len(ticks) != 4 {
+		t.Fatalf("LoadFile(json) = %d ticks, %v", len(ticks), err)
+	}
+	if ticks, err := LoadFile(csv); err != nil || len(ticks) != 2 {
+		t.Fatalf("LoadFile(csv) = %d ticks, %v", len(ticks), err)
+	}
+	if _, err := LoadFile(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Fatal("LoadFile succeeded on a missing file")
+	}
+}
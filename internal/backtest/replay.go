@@ -0,0 +1,49 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/rules"
+)
+
+// Fire is a point where an alert would have fired.
+type Fire struct {
+	Time  time.Time
+	Price float64
+}
+
+// Result is the replay outcome for one alert. Suppressed counts crossings
+// that fell inside the cooldown after a previous fire.
+type Result struct {
+	Alert      domain.Alert
+	Fires      []Fire
+	Suppressed int
+}
+
+// Run replays ticks through rules.Crosses for every alert, as the engine does
+// live: the first tick only sets the baseline. With a cooldown, which the
+// live engine doesn't have, crossings within it after a fire are counted as
+// suppressed instead; pass 0 to match live behaviour.
+func Run(ticks []Tick, alerts []domain.Alert, cooldown time.Duration) []Result {
+	out := make([]Result, len(alerts))
+	for i := range alerts {
+		out[i].Alert = alerts[i]
+	}
+	var prev float64
+	for _, tk := range ticks {
+		for i := range out {
+			r := &out[i]
+			if !rules.Crosses(prev, tk.Price, &r.Alert) {
+				continue
+			}
+			if n := len(r.Fires); n > 0 && cooldown > 0 && tk.Time.Sub(r.Fires[n-1].Time) < cooldown {
+				r.Suppressed++
+				continue
+			}
+			r.Fires = append(r.Fires, Fire{Time: tk.Time, Price: tk.Price})
+		}
+		prev = tk.Price
+	}
+	return out
+}
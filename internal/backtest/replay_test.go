@@ -0,0 +1,39 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+)
+
+func TestRun(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	var ticks []Tick
+	// Starting above 100 is only the baseline, not a crossing.
+	for i, p := range []float64{101, 99, 101, 99, 101, 102, 99} {
+		ticks = append(ticks, Tick{Time: t0.Add(time.Duration(i) * 10 * time.Minute), Price: p})
+	}
+	up := domain.Alert{Kind: domain.KindPrice, Symbol: "BTCUSDT", Threshold: 100, Direction: domain.DirectionUp}
+	down := domain.Alert{Kind: domain.KindPrice, Symbol: "BTCUSDT", Threshold: 100, Direction: domain.DirectionDown}
+
+	res := Run(ticks, []domain.Alert{up, down}, 0)
+	if n := len(res[0].Fires); n != 2 || res[0].Suppressed != 0 {
+		t.Fatalf("up: %d fires, %d suppressed, want 2 and 0", n, res[0].Suppressed)
+	}
+	if f := res[0].Fires[0]; !f.Time.Equal(t0.Add(20*time.Minute)) || f.Price != 101 {
+		t.Fatalf("first up fire = %+v", f)
+	}
+	if n := len(res[1].Fires); n != 3 {
+		t.Fatalf("down: %d fires, want 3", n)
+	}
+
+	// A 25 minute cooldown swallows the crossings 20 minutes after a fire.
+	res = Run(ticks, []domain.Alert{up, down}, 25*time.Minute)
+	if n := len(res[0].Fires); n != 1 || res[0].Suppressed != 1 {
+		t.Fatalf("up with cooldown: %d fires, %d suppressed, want 1 and 1", n, res[0].Suppressed)
+	}
+	if n := len(res[1].Fires); n != 2 || res[1].Suppressed != 1 {
+		t.Fatalf("down with cooldown: %d fires, %d suppressed, want 2 and 1", n, res[1].Suppressed)
+	}
+}
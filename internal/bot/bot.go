@@ -0,0 +1,216 @@
+// Package bot lets the configured Telegram chats manage alerts with slash
+// commands, using the same App methods as the web handlers.
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/app"
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram"
+)
+
+const help = `Commands:
+/add SYMBOL up|down THRESHOLD [info|warning|critical]
+  (SYMBOL may be A/B for a ratio, A-B for a spread, or
+  A@binance~coinbase for the % gap of A between two exchanges)
+/list
+/pause ID
+/resume ID
+/delete ID
+/price SYMBOL`
+
+type Bot struct {
+	app     *app.App
+	client  *telegram.Client
+	targets []telegram.Target
+}
+
+// New returns a bot that takes commands from the chats in chatID, a
+// TELEGRAM_CHAT_ID value: a comma-separated list where a "chat:thread" entry
+// only accepts commands from that forum topic.
+func New(a *app.App, c *telegram.Client, chatID string) (*Bot, error) {
+	targets, err := telegram.ParseTargets(chatID)
+	if err != nil {
+		return nil, err
+	}
+	return &Bot{app: a, client: c, targets: targets}, nil
+}
+
+// Run long-polls getUpdates until ctx is cancelled. Messages from chats and
+// topics other than the configured ones are ignored; replies go back to the
+// chat and topic a command came from.
+func (b *Bot) Run(ctx context.Context) {
+	var offset int64
+	for {
+		updates, err := b.client.GetUpdates(ctx, offset, 50*time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error().Err(err).Msg("telegram getUpdates failed")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			m := u.Message
+			if m == nil || !b.accepts(m) {
+				continue
+			}
+			reply := b.Handle(ctx, m.Text)
+			if reply == "" {
+				continue
+			}
+			if err := b.client.Send(ctx, telegram.OutgoingMessage{
+				ChatID:          strconv.FormatInt(m.Chat.ID, 10),
+				MessageThreadID: m.MessageThreadID,
+				Text:            reply,
+			}); err != nil {
+				log.Error().Err(err).Msg("telegram reply failed")
+			}
+		}
+	}
+}
+
+func (b *Bot) accepts(m *telegram.Message) bool {
+	for _, t := range b.targets {
+		if t.Matches(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle executes a single command and returns the reply text.
+func (b *Bot) Handle(ctx context.Context, text string) string {
+	f := strings.Fields(text)
+	if len(f) == 0 || !strings.HasPrefix(f[0], "/") {
+		return ""
+	}
+	// Commands in groups arrive as /cmd@BotName.
+	cmd, _, _ := strings.Cut(strings.ToLower(f[0]), "@")
+	args := f[1:]
+
+	switch cmd {
+	case "/start", "/help":
+		return help
+	case "/add":
+		return b.add(args)
+	case "/list":
+		return b.list()
+	case "/pause":
+		return b.toggle(args, false)
+	case "/resume":
+		return b.toggle(args, true)
+	case "/delete":
+		if len(args) != 1 {
+			return "usage: /delete ID"
+		}
+		if err := b.app.DeleteAlert(args[0]); err != nil {
+			return errText(err)
+		}
+		return "Deleted " + args[0]
+	case "/price":
+		if len(args) != 1 {
+			return "usage: /price SYMBOL"
+		}
+		sym := strings.ToUpper(args[0])
+		p, err := b.app.Price(ctx, sym)
+		if err != nil {
+			return errText(err)
+		}
+		return fmt.Sprintf("%s %.8f", sym, p)
+	default:
+		return "unknown command\n" + help
+	}
+}
+
+func (b *Bot) add(args []string) string {
+	if len(args) != 3 && len(args) != 4 {
+		return "usage: /add SYMBOL up|down THRESHOLD [info|warning|critical]"
+	}
+	thr, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return "threshold must be a number"
+	}
+	al := domain.Alert{
+		Kind:      domain.KindPrice,
+		Symbol:    strings.ToUpper(args[0]),
+		Threshold: thr,
+		Direction: domain.Direction(strings.ToUpper(args[1])),
+	}
+	if sym, exs, ok := strings.Cut(args[0], "@"); ok {
+		al.Kind, al.Symbol = domain.KindArbitrage, strings.ToUpper(sym)
+		al.Exchange, al.PairExchange, _ = strings.Cut(strings.ToLower(exs), "~")
+	} else if a, b, ok := strings.Cut(al.Symbol, "/"); ok {
+		al.Kind, al.Symbol, al.PairSymbol = domain.KindRatio, a, b
+	} else if a, b, ok := strings.Cut(al.Symbol, "-"); ok {
+		al.Kind, al.Symbol, al.PairSymbol = domain.KindSpread, a, b
+	}
+	if len(args) == 4 {
+		al.Severity = domain.Severity(strings.ToUpper(args[3]))
+	}
+	al, err = b.app.CreateAlert(al)
+	if err != nil {
+		return errText(err)
+	}
+	return fmt.Sprintf("Created %s: %s %s %.8f [%s]", al.ID, al.Series(), al.Direction, al.Threshold, al.Severity)
+}
+
+func (b *Bot) list() string {
+	list, err := b.app.ListAlerts()
+	if err != nil {
+		return errText(err)
+	}
+	if len(list) == 0 {
+		return "No alerts yet."
+	}
+	var sb strings.Builder
+	for _, al := range list {
+		status := "on"
+		if !al.Enabled {
+			status = "paused"
+		}
+		if al.Expr != "" {
+			fmt.Fprintf(&sb, "%s when %s %s [%s]\n", al.ID, al.Expr, al.Severity, status)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s %s %s %.8f %s [%s]\n", al.ID, al.Series(), al.Direction, al.Threshold, al.Severity, status)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func (b *Bot) toggle(args []string, enabled bool) string {
+	if len(args) != 1 {
+		if enabled {
+			return "usage: /resume ID"
+		}
+		return "usage: /pause ID"
+	}
+	if err := b.app.ToggleAlert(args[0], enabled); err != nil {
+		return errText(err)
+	}
+	if enabled {
+		return "Resumed " + args[0]
+	}
+	return "Paused " + args[0]
+}
+
+func errText(err error) string {
+	if errors.Is(err, app.ErrAlertNotFound) {
+		return "No such alert."
+	}
+	return "Error: " + err.Error()
+}
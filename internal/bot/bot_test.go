@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nuid"
+
+	"github.com/Secretstar513/crypto-alerts/internal/app"
+	"github.com/Secretstar513/crypto-alerts/internal/config"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram/telegramtest"
+)
+
+// newTestApp starts an App on a private in-memory database whose price feeds
+// point at addresses nothing listens on.
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+	cfg := config.Default()
+	cfg.DBPath = fmt.Sprintf("file:%s?mode=memory&cache=shared", nuid.Next())
+	cfg.BinanceWSURL = "ws://127.0.0.1:1"
+	cfg.BinanceRESTURL = "http://127.0.0.1:1"
+	cfg.CoinbaseWSURL = "ws://127.0.0.1:1"
+	cfg.CoinbaseRESTURL = "http://127.0.0.1:1"
+	cfg.TelegramAPIURL = "http://127.0.0.1:1"
+	a := app.New(cfg)
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		_ = a.Stop()
+	})
+	return a
+}
+
+// runBot runs a bot for chatID against a fake Bot API until the test ends.
+func runBot(t *testing.T, a *app.App, chatID string) *telegramtest.Server {
+	t.Helper()
+	tg := telegramtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	b, err := New(a, telegram.NewClient(tg.URL, "123:TOKEN"), chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return tg
+}
+
+// waitSent waits until tg has received n replies and returns them.
+func waitSent(t *testing.T, tg *telegramtest.Server, n int) []telegramtest.Sent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sent := tg.Sent()
+		if len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d replies, got %d", n, len(sent))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	b, err := New(newTestApp(t), nil, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		text, want string
+	}{
+		{"hello", ""},
+		{"", ""},
+		{"/help", help},
+		{"/start@AlertsBot", help},
+		{"/nope", "unknown command\n" + help},
+		{"/add BTCUSDT up", "usage: /add SYMBOL up|down THRESHOLD [info|warning|critical]"},
+		{"/add BTCUSDT up lots", "threshold must be a number"},
+		{"/add BTCUSDT sideways 100", "Error: "},
+		{"/list", "No alerts yet."},
+		{"/pause", "usage: /pause ID"},
+		{"/resume a b", "usage: /resume ID"},
+		{"/delete", "usage: /delete ID"},
+		{"/delete nosuchalert", "No such alert."},
+		{"/price", "usage: /price SYMBOL"},
+	} {
+		got := b.Handle(ctx, tc.text)
+		if tc.want == "" && got != "" || !strings.HasPrefix(got, tc.want) {
+			t.Errorf("Handle(%q) = %q, want prefix %q", tc.text, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		text, series string
+	}{
+		{"/add btcusdt up 65000 critical", "BTCUSDT"},
+		{"/add ETHUSDT/BTCUSDT down 0.05", "ETHUSDT/BTCUSDT"},
+		{"/add ETHUSDT-BTCUSDT up 10", "ETHUSDT-BTCUSDT"},
+		{"/add BTCUSDT@binance~coinbase up 0.5", "BTCUSDT@binance~coinbase"},
+	} {
+		got := b.Handle(ctx, tc.text)
+		if !strings.HasPrefix(got, "Created ") || !strings.Contains(got, ": "+tc.series+" ") {
+			t.Errorf("Handle(%q) = %q, want an alert on %s", tc.text, got, tc.series)
+		}
+	}
+
+	created := b.Handle(ctx, "/add SOLUSDT down 150 warning")
+	id := strings.TrimSuffix(strings.Fields(created)[1], ":")
+	if got := b.Handle(ctx, "/pause "+id); got != "Paused "+id {
+		t.Fatalf("/pause = %q", got)
+	}
+	if got := b.Handle(ctx, "/list"); !strings.Contains(got, id+" SOLUSDT DOWN 150.00000000 WARNING [paused]") {
+		t.Fatalf("/list after pause = %q", got)
+	}
+	if got := b.Handle(ctx, "/resume "+id); got != "Resumed "+id {
+		t.Fatalf("/resume = %q", got)
+	}
+	if got := b.Handle(ctx, "/delete "+id); got != "Deleted "+id {
+		t.Fatalf("/delete = %q", got)
+	}
+	if got := b.Handle(ctx, "/list"); strings.Contains(got, id) {
+		t.Fatalf("/list after delete still shows %s: %q", id, got)
+	}
+}
+
+func TestRunRepliesToConfiguredChatOnly(t *testing.T) {
+	tg := runBot(t, newTestApp(t), "42")
+
+	tg.PushMessage(7, "/help")
+	tg.PushMessage(42, "/list")
+	sent := waitSent(t, tg, 1)
+	if sent[0].Body["chat_id"] != "42" || sent[0].Body["text"] != "No alerts yet." {
+		t.Fatalf("reply = %v, want No alerts yet. to chat 42", sent[0].Body)
+	}
+
+	// Updates already handled must not be delivered again: the next poll
+	// asks for the ID after the last one seen.
+	tg.PushMessage(42, "/add BTCUSDT up 65000")
+	waitSent(t, tg, 2)
+	tg.PushMessage(42, "/list")
+	waitSent(t, tg, 3)
+	time.Sleep(50 * time.Millisecond)
+	if sent = tg.Sent(); len(sent) != 3 {
+		t.Fatalf("got %d replies, want 3: %v", len(sent), sent)
+	}
+	if text, _ := sent[1].Body["text"].(string); !strings.HasPrefix(text, "Created ") {
+		t.Fatalf("second reply = %q, want Created …", text)
+	}
+	if text, _ := sent[2].Body["text"].(string); !strings.Contains(text, "BTCUSDT UP 65000.00000000") {
+		t.Fatalf("third reply = %q, want the new alert listed", text)
+	}
+}
+
+func TestRunAcceptsEveryConfiguredTarget(t *testing.T) {
+	a := newTestApp(t)
+	type msg struct {
+		chat, thread int64
+	}
+	for _, tc := range []struct {
+		chatID   string
+		accepted []msg
+		ignored  []msg
+	}{
+		{"42", []msg{{42, 0}, {42, 5}}, []msg{{7, 0}}},
+		{"42, -1001", []msg{{42, 0}, {-1001, 0}}, []msg{{7, 0}}},
+		{"-1001:5,42", []msg{{-1001, 5}, {42, 9}}, []msg{{-1001, 0}, {-1001, 6}, {7, 5}}},
+	} {
+		t.Run(tc.chatID, func(t *testing.T) {
+			tg := runBot(t, a, tc.chatID)
+			// Ignored messages go first so any reply to them is seen before
+			// the replies the test waits for.
+			for _, m := range append(tc.ignored, tc.accepted...) {
+				tg.PushTopicMessage(m.chat, m.thread, "/help")
+			}
+			waitSent(t, tg, len(tc.accepted))
+			time.Sleep(50 * time.Millisecond)
+			sent := tg.Sent()
+			if len(sent) != len(tc.accepted) {
+				t.Fatalf("got %d replies, want %d: %v", len(sent), len(tc.accepted), sent)
+			}
+			for i, m := range tc.accepted {
+				body := sent[i].Body
+				thread, _ := body["message_thread_id"].(float64)
+				if body["chat_id"] != fmt.Sprint(m.chat) || int64(thread) != m.thread {
+					t.Errorf("reply %d went to chat %v thread %v, want %d thread %d",
+						i, body["chat_id"], body["message_thread_id"], m.chat, m.thread)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRejectsBadThread(t *testing.T) {
+	if _, err := New(nil, nil, "42:general"); err == nil {
+		t.Fatal("New accepted a non-numeric thread ID")
+	}
+}
@@ -1,48 +1,242 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+
+	"github.com/Secretstar513/crypto-alerts/internal/secrets"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram"
 )
 
 type Config struct {
-	Addr           string
-	DBPath         string
-	SMTPHost       string
-	SMTPPort       string
-	SMTPUser       string
-	SMTPPass       string
-	EmailFrom      string
-	EmailTo        string
-	TelegramBotToken string
-	TelegramChatID   string
+	Addr              string
+	DBPath            string
+	SMTPHost          string
+	SMTPPort          string
+	SMTPUser          string
+	SMTPPass          string
+	EmailFrom         string
+	EmailTo           string
+	TelegramBotToken  string
+	TelegramChatID    string
+	TelegramAPIURL    string
+	TelegramParseMode string
+	TelegramCommands  bool
+	// CandleRetention is how long candles are kept, by interval (1m, 5m, 1h).
+	CandleRetention map[string]time.Duration
+	// PriceRecordFile, if set, appends every live price update to this file.
+	PriceRecordFile string
+	// PriceReplayFile, if set, replaces the Binance feed with a recording,
+	// played back PriceReplaySpeed times faster than real time.
+	PriceReplayFile  string
+	PriceReplaySpeed float64
+	// BinanceWSURL and BinanceRESTURL are the exchange base URLs; point them at
+	// testnet, a proxy or a local stub.
+	BinanceWSURL   string
+	BinanceRESTURL string
+	// CoinbaseWSURL and CoinbaseRESTURL are the Coinbase Exchange base URLs,
+	// streamed only for arbitrage alerts that compare against Coinbase.
+	CoinbaseWSURL   string
+	CoinbaseRESTURL string
+	// PollInterval is how often prices are polled over REST while the
+	// WebSocket is down. Retries of the WebSocket back off from
+	// ReconnectDelay to ReconnectMaxDelay, with jitter.
+	PollInterval      time.Duration
+	ReconnectDelay    time.Duration
+	ReconnectMaxDelay time.Duration
+	// EngineTick is how often the engine picks up new alerts and evaluates
+	// buffered price updates.
+	EngineTick time.Duration
+	// PairMaxSkew is how far apart the latest updates of the two legs of a
+	// ratio or spread alert may be for their combined value to count.
+	PairMaxSkew time.Duration
+	// StaleAfter is how long a symbol with enabled alerts may go without a
+	// price update before the channels are told its feed is stale.
+	StaleAfter time.Duration
+	// ShutdownTimeout bounds how long shutdown waits for in-flight work,
+	// notifications included, before cancelling it.
+	ShutdownTimeout time.Duration
+	// SecretsKey or SecretsKeyFile holds the base64 master key that channel
+	// configs are encrypted with. SecretsPreviousKeys lists, comma-separated,
+	// retired keys that configs are re-encrypted from at startup.
+	SecretsKey          string
+	SecretsKeyFile      string
+	SecretsPreviousKeys string
 }
 
-func Load() *Config {
+// Default returns the settings used when neither the config file nor the
+// environment sets them.
+func Default() *Config {
+	return &Config{
+		Addr:           ":8080",
+		DBPath:         "alerts.db",
+		TelegramAPIURL: "https://api.telegram.org",
+		CandleRetention: map[string]time.Duration{
+			"1m": 48 * time.Hour,
+			"5m": 14 * 24 * time.Hour,
+			"1h": 365 * 24 * time.Hour,
+		},
+		PriceReplaySpeed:  1,
+		BinanceWSURL:      "wss://stream.binance.com:9443",
+		BinanceRESTURL:    "https://api.binance.com",
+		CoinbaseWSURL:     "wss://ws-feed.exchange.coinbase.com",
+		CoinbaseRESTURL:   "https://api.exchange.coinbase.com",
+		PollInterval:      10 * time.Second,
+		ReconnectDelay:    time.Second,
+		ReconnectMaxDelay: 2 * time.Minute,
+		EngineTick:        5 * time.Second,
+		PairMaxSkew:       15 * time.Second,
+		StaleAfter:        2 * time.Minute,
+		ShutdownTimeout:   10 * time.Second,
+	}
+}
+
+// Load builds the config from the defaults, then the YAML file at path (if
+// any), then environment variables (including .env), each overriding the
+// last. Malformed values are errors; call Validate to check the result.
+func Load(path string) (*Config, error) {
 	_ = godotenv.Load()
 
-	c := &Config{
-		Addr:     get("ADDR", ":8080"),
-		DBPath:   get("DB_PATH", "alerts.db"),
-		SMTPHost: os.Getenv("SMTP_HOST"),
-		SMTPPort: os.Getenv("SMTP_PORT"),
-		SMTPUser: os.Getenv("SMTP_USER"),
-		SMTPPass: os.Getenv("SMTP_PASS"),
-		EmailFrom: os.Getenv("EMAIL_FROM"),
-		EmailTo:   os.Getenv("EMAIL_TO"),
-		TelegramBotToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
-		TelegramChatID:   os.Getenv("TELEGRAM_CHAT_ID"),
+	c := Default()
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadEnv(); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Config loaded: addr=%s db=%s", c.Addr, c.DBPath)
-	return c
+	return c, nil
 }
 
-func get(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+func (c *Config) loadEnv() error {
+	var errs []error
+	for _, s := range c.settings() {
+		v := os.Getenv(s.env)
+		if v == "" {
+			continue
+		}
+		if err := s.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%q: %w", s.env, v, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting that would keep the app from running or a
+// channel from delivering.
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(env string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", label(env), fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		bad("ADDR", "%v", err)
+	}
+	if c.DBPath == "" {
+		bad("DB_PATH", "must not be empty")
+	}
+	if err := checkURL(c.BinanceWSURL, "ws", "wss"); err != nil {
+		bad("BINANCE_WS_URL", "%v", err)
+	}
+	if err := checkURL(c.BinanceRESTURL, "http", "https"); err != nil {
+		bad("BINANCE_REST_URL", "%v", err)
+	}
+	if err := checkURL(c.CoinbaseWSURL, "ws", "wss"); err != nil {
+		bad("COINBASE_WS_URL", "%v", err)
+	}
+	if err := checkURL(c.CoinbaseRESTURL, "http", "https"); err != nil {
+		bad("COINBASE_REST_URL", "%v", err)
+	}
+	for _, s := range c.settings() {
+		if s.duration != nil && *s.duration <= 0 {
+			bad(s.env, "must be positive, got %s", *s.duration)
+		}
+	}
+	if c.ReconnectMaxDelay < c.ReconnectDelay {
+		bad("PRICE_RECONNECT_MAX_DELAY", "%s is below %s %s", c.ReconnectMaxDelay, label("PRICE_RECONNECT_DELAY"), c.ReconnectDelay)
+	}
+	if c.PriceReplaySpeed < 0 {
+		bad("PRICE_REPLAY_SPEED", "must not be negative, got %g", c.PriceReplaySpeed)
+	}
+	if c.PriceReplayFile != "" {
+		if _, err := os.Stat(c.PriceReplayFile); err != nil {
+			bad("PRICE_REPLAY_FILE", "%v", err)
+		}
+	}
+
+	if c.SMTPPort != "" {
+		if p, err := strconv.Atoi(c.SMTPPort); err != nil || p < 1 || p > 65535 {
+			bad("SMTP_PORT", "%q is not a port number", c.SMTPPort)
+		}
+	}
+	email := []struct{ env, v string }{{"SMTP_PORT", c.SMTPPort}, {"EMAIL_FROM", c.EmailFrom}, {"EMAIL_TO", c.EmailTo}}
+	for _, f := range email {
+		if c.SMTPHost != "" && f.v == "" {
+			bad(f.env, "required when %s is set", label("SMTP_HOST"))
+		}
+	}
+	for _, f := range email[1:] {
+		if _, err := mail.ParseAddress(f.v); f.v != "" && err != nil {
+			bad(f.env, "%q: %v", f.v, err)
+		}
+	}
+
+	if err := checkURL(c.TelegramAPIURL, "http", "https"); err != nil {
+		bad("TELEGRAM_API_URL", "%v", err)
+	}
+	switch c.TelegramParseMode {
+	case "", "MarkdownV2", "HTML":
+	default:
+		bad("TELEGRAM_PARSE_MODE", "%q: must be MarkdownV2, HTML or empty", c.TelegramParseMode)
+	}
+	if _, err := telegram.ParseTargets(c.TelegramChatID); err != nil {
+		bad("TELEGRAM_CHAT_ID", "%v", err)
+	}
+
+	if _, err := c.Keyring(); err != nil {
+		bad("SECRETS_KEY", "%v", err)
+	}
+	return errors.Join(errs...)
+}
+
+// Keyring returns the keyring for encrypting channel configs, or nil if no
+// master key is configured.
+func (c *Config) Keyring() (*secrets.Keyring, error) {
+	var previous []string
+	for _, k := range strings.Split(c.SecretsPreviousKeys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			previous = append(previous, k)
+		}
+	}
+	return secrets.LoadKeyring(c.SecretsKey, c.SecretsKeyFile, previous)
+}
+
+func checkURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
+	for _, s := range schemes {
+		if u.Scheme == s {
+			return nil
+		}
 	}
-	return def
+	return fmt.Errorf("%q: scheme must be one of %v", raw, schemes)
 }
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  addr: ":9000"
+  shutdownTimeout: 30s
+database:
+  path: file.db
+  candleRetention:
+    1m: 6h
+price:
+  pollInterval: 3s
+notifiers:
+  telegram:
+    commands: true
+`)
+	t.Setenv("ADDR", ":9100")
+	t.Setenv("CANDLE_RETENTION_1M", "12h")
+	t.Setenv("TELEGRAM_COMMANDS", "")
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		got, want any
+	}{
+		{"env over file", c.Addr, ":9100"},
+		{"env over file, map", c.CandleRetention["1m"], 12 * time.Hour},
+		{"file over default", c.DBPath, "file.db"},
+		{"file over default, duration", c.ShutdownTimeout, 30 * time.Second},
+		{"file over default, nested", c.PollInterval, 3 * time.Second},
+		{"empty env keeps file", c.TelegramCommands, true},
+		{"default", c.ReconnectDelay, time.Second},
+		{"default, map", c.CandleRetention["1h"], 365 * 24 * time.Hour},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, yaml string
+		want       []string
+	}{
+		{"unknown keys", "server:\n  adr: x\nprice:\n  binance:\n    wsUrl: y\n",
+			[]string{`unknown setting "price.binance.wsUrl"`, `unknown setting "server.adr"`}},
+		{"list", "notifiers:\n  email:\n    to: [a@example.com, b@example.com]\n",
+			[]string{"notifiers.email.to: lists aren't supported"}},
+		{"bad values", "server:\n  shutdownTimeout: soon\nprice:\n  replaySpeed: fast\n",
+			[]string{"server.shutdownTimeout", "price.replaySpeed"}},
+		{"non-positive retention", "database:\n  candleRetention:\n    5m: 0s\n",
+			[]string{"database.candleRetention.5m: must be positive"}},
+	} {
+		_, err := Load(writeFile(t, tc.yaml))
+		if err == nil {
+			t.Errorf("%s: Load succeeded", tc.name)
+			continue
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%s: error %q does not mention %q", tc.name, err, w)
+			}
+		}
+	}
+
+	t.Setenv("PRICE_POLL_INTERVAL", "often")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), `PRICE_POLL_INTERVAL="often"`) {
+		t.Errorf("bad env value: got %v", err)
+	}
+}
+
+func TestValidateCollectsErrors(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("defaults invalid: %v", err)
+	}
+
+	c := Default()
+	c.Addr = "nope"
+	c.BinanceWSURL = "https://stream.binance.com"
+	c.ReconnectMaxDelay = 100 * time.Millisecond
+	c.SMTPHost = "smtp.example.com"
+	c.TelegramChatID = "42:general"
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid config")
+	}
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		t.Fatalf("Validate returned %T, want joined errors", err)
+	}
+	for _, want := range []string{
+		"server.addr (ADDR)",
+		"price.binance.wsURL (BINANCE_WS_URL)",
+		"price.reconnectMaxDelay (PRICE_RECONNECT_MAX_DELAY): 100ms is below price.reconnectDelay (PRICE_RECONNECT_DELAY) 1s",
+		"notifiers.email.port (SMTP_PORT): required when notifiers.email.host (SMTP_HOST) is set",
+		"notifiers.email.from (EMAIL_FROM)",
+		"notifiers.email.to (EMAIL_TO)",
+		"notifiers.telegram.chatID (TELEGRAM_CHAT_ID)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("errors don't mention %q:\n%v", want, err)
+		}
+	}
+	if n := len(joined.Unwrap()); n != 7 {
+		t.Errorf("got %d errors, want 7:\n%v", n, err)
+	}
+}
+
+func TestYAMLRedactsSecrets(t *testing.T) {
+	c := Default()
+	c.SMTPUser = "alerts@example.com"
+	c.SMTPPass = "hunter2"
+	c.TelegramBotToken = "123:SECRET"
+	c.TelegramChatID = "-1001:5"
+	c.SecretsPreviousKeys = "old-key"
+	out, err := c.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	for _, leaked := range []string{"hunter2", "123:SECRET", "old-key"} {
+		if strings.Contains(s, leaked) {
+			t.Errorf("YAML leaks %q:\n%s", leaked, s)
+		}
+	}
+	for _, want := range []string{
+		"pass: <redacted>",
+		"botToken: <redacted>",
+		"previousKeys: <redacted>",
+		"key:\n",
+		"user: alerts@example.com",
+		"chatID: -1001:5",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("YAML lacks %q:\n%s", want, s)
+		}
+	}
+
+	// The output is a valid config file that loads back to the same values.
+	c2 := Default()
+	if err := c2.loadFile(writeFile(t, s)); err != nil {
+		t.Fatalf("printed config doesn't load: %v", err)
+	}
+	if c2.SMTPUser != c.SMTPUser || c2.TelegramChatID != c.TelegramChatID {
+		t.Errorf("round trip changed values: %+v", c2)
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting binds one Config field to its key in the config file and its
+// environment variable.
+type setting struct {
+	key    string // dotted path in the file, e.g. "price.pollInterval"
+	env    string
+	secret bool
+	get    func() string
+	set    func(string) error
+	// duration points at the field for duration settings, which Validate
+	// requires to be positive.
+	duration *time.Duration
+}
+
+// settings lists every setting in the order the config file is printed.
+func (c *Config) settings() []setting {
+	return []setting{
+		str("server.addr", "ADDR", &c.Addr),
+		dur("server.shutdownTimeout", "SHUTDOWN_TIMEOUT", &c.ShutdownTimeout),
+
+		str("database.path", "DB_PATH", &c.DBPath),
+		retention("database.candleRetention.1m", "CANDLE_RETENTION_1M", c.CandleRetention, "1m"),
+		retention("database.candleRetention.5m", "CANDLE_RETENTION_5M", c.CandleRetention, "5m"),
+		retention("database.candleRetention.1h", "CANDLE_RETENTION_1H", c.CandleRetention, "1h"),
+
+		str("price.binance.wsURL", "BINANCE_WS_URL", &c.BinanceWSURL),
+		str("price.binance.restURL", "BINANCE_REST_URL", &c.BinanceRESTURL),
+		str("price.coinbase.wsURL", "COINBASE_WS_URL", &c.CoinbaseWSURL),
+		str("price.coinbase.restURL", "COINBASE_REST_URL", &c.CoinbaseRESTURL),
+		dur("price.pollInterval", "PRICE_POLL_INTERVAL", &c.PollInterval),
+		dur("price.reconnectDelay", "PRICE_RECONNECT_DELAY", &c.ReconnectDelay),
+		dur("price.reconnectMaxDelay", "PRICE_RECONNECT_MAX_DELAY", &c.ReconnectMaxDelay),
+		str("price.recordFile", "PRICE_RECORD_FILE", &c.PriceRecordFile),
+		str("price.replayFile", "PRICE_REPLAY_FILE", &c.PriceReplayFile),
+		float("price.replaySpeed", "PRICE_REPLAY_SPEED", &c.PriceReplaySpeed),
+
+		str("notifiers.email.host", "SMTP_HOST", &c.SMTPHost),
+		str("notifiers.email.port", "SMTP_PORT", &c.SMTPPort),
+		str("notifiers.email.user", "SMTP_USER", &c.SMTPUser),
+		secret(str("notifiers.email.pass", "SMTP_PASS", &c.SMTPPass)),
+		str("notifiers.email.from", "EMAIL_FROM", &c.EmailFrom),
+		str("notifiers.email.to", "EMAIL_TO", &c.EmailTo),
+		secret(str("notifiers.telegram.botToken", "TELEGRAM_BOT_TOKEN", &c.TelegramBotToken)),
+		str("notifiers.telegram.chatID", "TELEGRAM_CHAT_ID", &c.TelegramChatID),
+		str("notifiers.telegram.apiURL", "TELEGRAM_API_URL", &c.TelegramAPIURL),
+		str("notifiers.telegram.parseMode", "TELEGRAM_PARSE_MODE", &c.TelegramParseMode),
+		boolean("notifiers.telegram.commands", "TELEGRAM_COMMANDS", &c.TelegramCommands),
+
+		dur("engine.tick", "ENGINE_TICK", &c.EngineTick),
+		dur("engine.staleAfter", "FEED_STALE_AFTER", &c.StaleAfter),
+		dur("engine.pairMaxSkew", "PAIR_MAX_SKEW", &c.PairMaxSkew),
+
+		secret(str("secrets.key", "SECRETS_KEY", &c.SecretsKey)),
+		str("secrets.keyFile", "SECRETS_KEY_FILE", &c.SecretsKeyFile),
+		secret(str("secrets.previousKeys", "SECRETS_PREVIOUS_KEYS", &c.SecretsPreviousKeys)),
+	}
+}
+
+func str(key, env string, p *string) setting {
+	return setting{key: key, env: env,
+		get: func() string { return *p },
+		set: func(v string) error { *p = v; return nil },
+	}
+}
+
+func dur(key, env string, p *time.Duration) setting {
+	return setting{key: key, env: env, duration: p,
+		get: func() string { return p.String() },
+		set: func(v string) (err error) { *p, err = time.ParseDuration(v); return },
+	}
+}
+
+func retention(key, env string, m map[string]time.Duration, interval string) setting {
+	return setting{key: key, env: env,
+		get: func() string { return m[interval].String() },
+		set: func(v string) error {
+			d, err := time.ParseDuration(v)
+			if err == nil && d <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+			m[interval] = d
+			return err
+		},
+	}
+}
+
+func float(key, env string, p *float64) setting {
+	return setting{key: key, env: env,
+		get: func() string { return strconv.FormatFloat(*p, 'f', -1, 64) },
+		set: func(v string) (err error) { *p, err = strconv.ParseFloat(v, 64); return },
+	}
+}
+
+func boolean(key, env string, p *bool) setting {
+	return setting{key: key, env: env,
+		get: func() string { return strconv.FormatBool(*p) },
+		set: func(v string) (err error) { *p, err = strconv.ParseBool(v); return },
+	}
+}
+
+func secret(s setting) setting {
+	s.secret = true
+	return s
+}
+
+// fileKeys maps each setting's environment variable to its file key.
+var fileKeys = func() map[string]string {
+	m := map[string]string{}
+	for _, s := range Default().settings() {
+		m[s.env] = s.key
+	}
+	return m
+}()
+
+// label names a setting in error messages by both of its spellings.
+func label(env string) string {
+	if key, ok := fileKeys[env]; ok {
+		return key + " (" + env + ")"
+	}
+	return env
+}
+
+// loadFile applies the settings present in the YAML file at path. Unknown
+// keys are rejected so typos don't silently fall back to defaults.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var root map[string]any
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	values := map[string]string{}
+	if err := flatten("", root, values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var errs []error
+	for _, s := range c.settings() {
+		v, ok := values[s.key]
+		if !ok {
+			continue
+		}
+		delete(values, s.key)
+		if err := s.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, s.key, err))
+		}
+	}
+	unknown := make([]string, 0, len(values))
+	for k := range values {
+		unknown = append(unknown, k)
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, k))
+	}
+	return errors.Join(errs...)
+}
+
+func flatten(prefix string, m map[string]any, out map[string]string) error {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			if err := flatten(key, v, out); err != nil {
+				return err
+			}
+		case []any:
+			return fmt.Errorf("%s: lists aren't supported; use a comma-separated string", key)
+		case nil:
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// YAML renders the effective config in config-file form. Secrets that are
+// set print as "<redacted>". Identifiers such as SMTP_USER and
+// TELEGRAM_CHAT_ID aren't secrets and print as they are, so the output shows
+// where alerts go.
+func (c *Config) YAML() ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range c.settings() {
+		parts := strings.Split(s.key, ".")
+		node := root
+		for _, p := range parts[:len(parts)-1] {
+			node = child(node, p)
+		}
+		v := s.get()
+		if s.secret && v != "" {
+			v = "<redacted>"
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: parts[len(parts)-1]},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: v},
+		)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// child returns the mapping under key in n, adding it if missing.
+func child(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	m := &yaml.Node{Kind: yaml.MappingNode}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, m)
+	return m
+}
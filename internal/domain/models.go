@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"time"
+)
 
 type Direction string
 
@@ -9,16 +13,172 @@ const (
 	DirectionDown Direction = "DOWN"
 )
 
+type Severity string
+
+const (
+	SeverityInfo     Severity = "INFO"
+	SeverityWarning  Severity = "WARNING"
+	SeverityCritical Severity = "CRITICAL"
+)
+
+// Rank orders severities from INFO (0) to CRITICAL (2); unknown values rank as INFO.
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityWarning:
+		return 1
+	case SeverityCritical:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// AlertKind is the series an alert's threshold applies to: the symbol's
+// price, or a value derived from it and PairSymbol, or from its prices on
+// two exchanges, or an indicator over its candles.
+type AlertKind string
+
+const (
+	KindPrice     AlertKind = "PRICE"
+	KindRatio     AlertKind = "RATIO"     // Symbol / PairSymbol
+	KindSpread    AlertKind = "SPREAD"    // Symbol - PairSymbol
+	KindArbitrage AlertKind = "ARBITRAGE" // % gap of Symbol between Exchange and PairExchange
+
+	// Indicator kinds, over Interval candles. The first three cross a moving
+	// line instead of Threshold.
+	KindSMA      AlertKind = "SMA"       // price crosses its Period SMA
+	KindEMA      AlertKind = "EMA"       // price crosses its Period EMA
+	KindEMACross AlertKind = "EMA_CROSS" // Period EMA crosses SlowPeriod EMA
+	KindRSI      AlertKind = "RSI"       // Period RSI crosses Threshold
+
+	// Kinds over the rolling 24h window of the ticker.
+	KindVolume AlertKind = "VOLUME"     // 24h quote volume crosses Threshold
+	KindChange AlertKind = "CHANGE_24H" // 24h % change crosses Threshold
+	KindHigh   AlertKind = "HIGH_24H"   // price breaks above its 24h high
+	KindLow    AlertKind = "LOW_24H"    // price breaks below its 24h low
+)
+
+// Indicator reports whether k is computed from candles.
+func (k AlertKind) Indicator() bool {
+	return k == KindSMA || k == KindEMA || k == KindEMACross || k == KindRSI
+}
+
+// Daily reports whether k watches the ticker's rolling 24h window.
+func (k AlertKind) Daily() bool {
+	return k == KindVolume || k == KindChange || k == KindHigh || k == KindLow
+}
+
+// Direction is the only direction a 24h high or low breakout can take;
+// other kinds return "".
+func (k AlertKind) Direction() Direction {
+	switch k {
+	case KindHigh:
+		return DirectionUp
+	case KindLow:
+		return DirectionDown
+	}
+	return ""
+}
+
+// Exchanges prices are read from. Every alert kind but ARBITRAGE uses
+// ExchangeBinance.
+const (
+	ExchangeBinance  = "binance"
+	ExchangeCoinbase = "coinbase"
+)
+
+var Exchanges = []string{ExchangeBinance, ExchangeCoinbase}
+
 type Alert struct {
-	ID        string    `gorm:"primaryKey"`
-	Symbol    string
-	Threshold float64
-	Direction Direction
-	Enabled   bool
+	ID     string    `gorm:"primaryKey"`
+	Kind   AlertKind `gorm:"default:PRICE"`
+	Symbol string
+	// PairSymbol is the second leg of RATIO and SPREAD alerts.
+	PairSymbol string
+	// Exchange and PairExchange are the exchanges an ARBITRAGE alert
+	// compares Symbol across.
+	Exchange     string
+	PairExchange string
+	// Interval (1m, 5m or 1h) is the candle size indicator alerts use, and
+	// Period and SlowPeriod their lengths in candles.
+	Interval   string
+	Period     int
+	SlowPeriod int
+	Threshold  float64
+	Direction  Direction
+	// Expr, if set, is a condition over one or more symbols (see rules.Parse)
+	// that replaces Threshold and Direction; Symbol is then the first symbol
+	// it references.
+	Expr     string   `gorm:"default:''"`
+	Severity Severity `gorm:"default:INFO"`
+	Enabled  bool
+	// Channels limits delivery to these channels; empty means every enabled channel.
+	Channels  []Channel `gorm:"many2many:alert_channels;"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// Series names the value the alert watches, e.g. BTCUSDT, ETHUSDT/BTCUSDT,
+// ETHUSDT-BTCUSDT, BTCUSDT@binance~coinbase, BTCUSDT RSI(14) 1h or
+// BTCUSDT 24h volume.
+func (a Alert) Series() string {
+	switch a.Kind {
+	case KindVolume:
+		return a.Symbol + " 24h volume"
+	case KindChange:
+		return a.Symbol + " 24h %"
+	case KindHigh:
+		return a.Symbol + " 24h high"
+	case KindLow:
+		return a.Symbol + " 24h low"
+	case KindSMA, KindEMA, KindRSI:
+		return fmt.Sprintf("%s %s(%d) %s", a.Symbol, a.Kind, a.Period, a.Interval)
+	case KindEMACross:
+		return fmt.Sprintf("%s EMA(%d)/EMA(%d) %s", a.Symbol, a.Period, a.SlowPeriod, a.Interval)
+	case KindRatio:
+		return a.Symbol + "/" + a.PairSymbol
+	case KindSpread:
+		return a.Symbol + "-" + a.PairSymbol
+	case KindArbitrage:
+		return a.Symbol + "@" + a.Exchange + "~" + a.PairExchange
+	}
+	return a.Symbol
+}
+
+// HasThreshold reports whether the alert fires on a fixed Threshold, rather
+// than a moving line such as an average or the 24h high.
+func (a Alert) HasThreshold() bool {
+	switch a.Kind {
+	case KindSMA, KindEMA, KindEMACross, KindHigh, KindLow:
+		return false
+	}
+	return true
+}
+
+// Legs returns the exchange and symbol of each price a RATIO, SPREAD or
+// ARBITRAGE alert combines.
+func (a Alert) Legs() (exchange, symbol, pairExchange, pairSymbol string) {
+	if a.Kind == KindArbitrage {
+		return a.Exchange, a.Symbol, a.PairExchange, a.Symbol
+	}
+	return ExchangeBinance, a.Symbol, ExchangeBinance, a.PairSymbol
+}
+
+// Derive computes the value a RATIO, SPREAD or ARBITRAGE alert watches from
+// the prices of its two legs; for other kinds it returns price. The
+// arbitrage gap is a percentage of pairPrice, always positive.
+func (a Alert) Derive(price, pairPrice float64) float64 {
+	switch a.Kind {
+	case KindRatio:
+		return price / pairPrice
+	case KindSpread:
+		return price - pairPrice
+	case KindArbitrage:
+		return math.Abs(price-pairPrice) / pairPrice * 100
+	}
+	return price
+}
+
 type ChannelKind string
 
 const (
@@ -27,17 +187,77 @@ const (
 	ChannelTelegram ChannelKind = "TELEGRAM"
 )
 
+type DigestMode string
+
+const (
+	DigestOff    DigestMode = "OFF"
+	DigestHourly DigestMode = "HOURLY"
+	DigestDaily  DigestMode = "DAILY"
+)
+
 type Channel struct {
-	ID        string      `gorm:"primaryKey"`
-	Kind      ChannelKind
-	Enabled   bool
-	Config    string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID      string `gorm:"primaryKey"`
+	Kind    ChannelKind
+	Enabled bool
+	// MinSeverity is the lowest alert severity this channel delivers.
+	MinSeverity Severity `gorm:"default:INFO"`
+	Schedule    Schedule `gorm:"embedded;embeddedPrefix:schedule_"`
+	// Digest batches alerts into one message per period instead of one each.
+	Digest        DigestMode `gorm:"default:OFF"`
+	DigestAt      string     // HH:MM in the schedule's time zone for daily digests and summaries
+	DailySummary  bool       // send open/high/low/close of watched symbols once a day
+	DigestSentAt  time.Time
+	SummarySentAt time.Time
+	Config        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 }
 
+// LastPrice is the latest price of Symbol on Exchange.
 type LastPrice struct {
-	Symbol    string  `gorm:"primaryKey"`
-	Price     float64
+	Exchange string `gorm:"primaryKey;default:binance"`
+	Symbol   string `gorm:"primaryKey"`
+	Price    float64
+	// Day is the 24h window reported with the price; zero when the source
+	// doesn't report one.
+	Day       DayStats `gorm:"embedded;embeddedPrefix:day_"`
 	UpdatedAt time.Time
 }
+
+// DayStats summarises a symbol's last 24 hours of trading. Volume is in
+// the base asset, QuoteVolume in the quote asset.
+type DayStats struct {
+	High          float64
+	Low           float64
+	Volume        float64
+	QuoteVolume   float64
+	ChangePercent float64
+}
+
+// Candle is an OHLC bar aggregated from price updates. Interval is one of
+// 1m, 5m or 1h; OpenTime is the UTC start of the bar.
+type Candle struct {
+	Symbol   string    `gorm:"primaryKey"`
+	Interval string    `gorm:"primaryKey"`
+	OpenTime time.Time `gorm:"primaryKey"`
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Count    int
+}
+
+// PendingEvent is a fired alert held back for a channel during its quiet
+// hours, delivered later as part of a digest.
+type PendingEvent struct {
+	ID        string `gorm:"primaryKey"`
+	ChannelID string `gorm:"index"`
+	Symbol    string
+	Price     float64
+	Threshold float64
+	Direction Direction
+	Condition string
+	Severity  Severity
+	FiredAt   time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietPolicy decides what happens to an alert that fires outside a channel's
+// delivery window.
+type QuietPolicy string
+
+const (
+	QuietQueue QuietPolicy = "QUEUE" // hold and send as one digest when the window opens
+	QuietDrop  QuietPolicy = "DROP"
+)
+
+var weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// Schedule restricts when a channel delivers. The zero value always delivers.
+type Schedule struct {
+	Timezone string // IANA name, e.g. Europe/Berlin; empty means UTC
+	From     string // window start, HH:MM local time
+	To       string // window end, HH:MM; may be earlier than From to wrap past midnight
+	Days     string // comma-separated MON..SUN; empty means every day
+
+	QuietPolicy QuietPolicy `gorm:"default:QUEUE"`
+	// CriticalOverride delivers CRITICAL alerts even outside the window.
+	CriticalOverride bool
+}
+
+// IsSet reports whether the schedule restricts delivery at all.
+func (s Schedule) IsSet() bool {
+	return s.From != "" || s.To != "" || s.Days != ""
+}
+
+// HasDay reports whether day (MON..SUN) is one of the allowed days.
+func (s Schedule) HasDay(day string) bool {
+	for _, d := range strings.Split(s.Days, ",") {
+		if strings.TrimSpace(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Location returns the schedule's time zone, UTC if unset or unknown.
+func (s Schedule) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Active reports whether t falls inside the delivery window.
+func (s Schedule) Active(t time.Time) bool {
+	if !s.IsSet() {
+		return true
+	}
+	t = t.In(s.Location())
+	if s.Days != "" && !s.HasDay(weekdays[t.Weekday()]) {
+		return false
+	}
+	from, _ := clockMinutes(s.From)
+	to, _ := clockMinutes(s.To)
+	if s.To == "" {
+		to = 24 * 60
+	}
+	now := t.Hour()*60 + t.Minute()
+	switch {
+	case from == to:
+		return true
+	case from < to:
+		return now >= from && now < to
+	default:
+		return now >= from || now < to
+	}
+}
+
+func clockMinutes(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("time %q must be HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// LastDigest returns the most recent digest boundary at or before t: the top
+// of the hour for HOURLY, or the channel's DigestAt time for DAILY. The zero
+// time is returned when digests are off.
+func (c Channel) LastDigest(t time.Time) time.Time {
+	t = t.In(c.Schedule.Location())
+	switch c.Digest {
+	case DigestHourly:
+		// Step back rather than rebuild the date: in the repeated hour when
+		// clocks fall back, time.Date picks the later offset.
+		return t.Truncate(time.Minute).Add(-time.Duration(t.Minute()) * time.Minute)
+	case DigestDaily:
+		return c.lastDaily(t)
+	}
+	return time.Time{}
+}
+
+// LastSummary returns the most recent daily summary time at or before t.
+func (c Channel) LastSummary(t time.Time) time.Time {
+	return c.lastDaily(t.In(c.Schedule.Location()))
+}
+
+func (c Channel) lastDaily(t time.Time) time.Time {
+	m, _ := clockMinutes(c.DigestAt)
+	at := time.Date(t.Year(), t.Month(), t.Day(), m/60, m%60, 0, 0, t.Location())
+	if at.After(t) {
+		at = at.AddDate(0, 0, -1)
+	}
+	return at
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // the DST cases need Europe/Berlin wherever the tests run
+)
+
+func at(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestScheduleActive(t *testing.T) {
+	overnight := Schedule{From: "22:00", To: "06:00"}
+	berlin := Schedule{Timezone: "Europe/Berlin", From: "09:00", To: "17:00"}
+	weekdays := Schedule{Days: "MON, TUE,WED,THU,FRI"}
+
+	for _, tc := range []struct {
+		name string
+		s    Schedule
+		at   string
+		want bool
+	}{
+		{"unset", Schedule{}, "2026-10-18T03:00:00Z", true},
+
+		{"overnight before midnight", overnight, "2026-10-19T23:30:00Z", true},
+		{"overnight at start", overnight, "2026-10-19T22:00:00Z", true},
+		{"overnight after midnight", overnight, "2026-10-20T05:59:00Z", true},
+		{"overnight at end", overnight, "2026-10-20T06:00:00Z", false},
+		{"overnight midday", overnight, "2026-10-20T12:00:00Z", false},
+
+		{"equal bounds", Schedule{From: "08:00", To: "08:00"}, "2026-10-20T03:00:00Z", true},
+		{"open end before", Schedule{From: "18:00"}, "2026-10-20T17:59:00Z", false},
+		{"open end until midnight", Schedule{From: "18:00"}, "2026-10-20T23:59:00Z", true},
+
+		// 09:30 local is 08:30Z in winter (CET) and 07:30Z in summer (CEST).
+		{"zone winter open", berlin, "2026-01-15T08:30:00Z", true},
+		{"zone winter UTC hour", berlin, "2026-01-15T07:30:00Z", false},
+		{"zone summer open", berlin, "2026-07-15T07:30:00Z", true},
+		{"zone summer closed", berlin, "2026-07-15T15:30:00Z", false},
+		{"unknown zone is UTC", Schedule{Timezone: "Mars/Olympus", From: "09:00", To: "17:00"}, "2026-07-15T08:30:00Z", false},
+
+		// DST starts 2026-03-29 at 01:00Z in Berlin: 08:30Z is 09:30 CET the
+		// day before and 10:30 CEST after.
+		{"spring forward before", Schedule{Timezone: "Europe/Berlin", From: "09:00", To: "10:00"}, "2026-03-28T08:30:00Z", true},
+		{"spring forward after", Schedule{Timezone: "Europe/Berlin", From: "09:00", To: "10:00"}, "2026-03-29T08:30:00Z", false},
+		{"spring forward shifted", Schedule{Timezone: "Europe/Berlin", From: "09:00", To: "10:00"}, "2026-03-29T07:30:00Z", true},
+
+		// 2026-10-17 is a Saturday, 2026-10-19 a Monday.
+		{"weekday", weekdays, "2026-10-19T12:00:00Z", true},
+		{"weekend", weekdays, "2026-10-17T12:00:00Z", false},
+		// 23:30Z Monday is already Tuesday 01:30 in Berlin.
+		{"day in zone", Schedule{Timezone: "Europe/Berlin", Days: "TUE"}, "2026-10-19T23:30:00Z", true},
+		{"day in zone other", Schedule{Timezone: "Europe/Berlin", Days: "MON"}, "2026-10-19T23:30:00Z", false},
+		// Days are those the current local time falls on, so the hours
+		// after midnight of a Friday-night window belong to Saturday.
+		{"overnight day mask", Schedule{From: "22:00", To: "06:00", Days: "FRI"}, "2026-10-16T23:00:00Z", true},
+		{"overnight day mask next day", Schedule{From: "22:00", To: "06:00", Days: "FRI"}, "2026-10-17T01:00:00Z", false},
+	} {
+		if got := tc.s.Active(at(t, tc.at)); got != tc.want {
+			t.Errorf("%s: Active(%s) = %v, want %v", tc.name, tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestChannelDigestBoundaries(t *testing.T) {
+	utc := Schedule{}
+	berlin := Schedule{Timezone: "Europe/Berlin"}
+
+	for _, tc := range []struct {
+		name    string
+		ch      Channel
+		at      string
+		digest  string
+		summary string
+	}{
+		{"off", Channel{DigestAt: "08:00"}, "2026-10-19T12:00:00Z", "", "2026-10-19T08:00:00Z"},
+		{"hourly", Channel{Digest: DigestHourly, Schedule: utc}, "2026-10-19T12:34:56Z", "2026-10-19T12:00:00Z", "2026-10-19T00:00:00Z"},
+		{"hourly on the hour", Channel{Digest: DigestHourly}, "2026-10-19T12:00:00Z", "2026-10-19T12:00:00Z", "2026-10-19T00:00:00Z"},
+		{"daily after", Channel{Digest: DigestDaily, DigestAt: "08:00"}, "2026-10-19T08:00:00Z", "2026-10-19T08:00:00Z", "2026-10-19T08:00:00Z"},
+		{"daily before", Channel{Digest: DigestDaily, DigestAt: "08:00"}, "2026-10-19T07:59:00Z", "2026-10-18T08:00:00Z", "2026-10-18T08:00:00Z"},
+		{"daily in zone", Channel{Digest: DigestDaily, DigestAt: "08:00", Schedule: berlin}, "2026-07-15T06:30:00Z", "2026-07-15T06:00:00Z", "2026-07-15T06:00:00Z"},
+
+		// Clocks go forward at 01:00Z on 2026-03-29: 08:00 local moves from
+		// 07:00Z to 06:00Z, and the day before was 23 hours long.
+		{"daily spring forward", Channel{Digest: DigestDaily, DigestAt: "08:00", Schedule: berlin}, "2026-03-29T06:30:00Z", "2026-03-29T06:00:00Z", "2026-03-29T06:00:00Z"},
+		{"daily spring forward before", Channel{Digest: DigestDaily, DigestAt: "08:00", Schedule: berlin}, "2026-03-29T05:30:00Z", "2026-03-28T07:00:00Z", "2026-03-28T07:00:00Z"},
+		// Clocks go back at 01:00Z on 2026-10-25, so 02:00–03:00 local
+		// happens twice; each pass gets its own hourly boundary.
+		{"hourly fall back first", Channel{Digest: DigestHourly, Schedule: berlin}, "2026-10-25T00:30:00Z", "2026-10-25T00:00:00Z", "2026-10-24T22:00:00Z"},
+		{"hourly fall back second", Channel{Digest: DigestHourly, Schedule: berlin}, "2026-10-25T01:30:00Z", "2026-10-25T01:00:00Z", "2026-10-24T22:00:00Z"},
+		{"daily fall back", Channel{Digest: DigestDaily, DigestAt: "08:00", Schedule: berlin}, "2026-10-25T07:30:00Z", "2026-10-25T07:00:00Z", "2026-10-25T07:00:00Z"},
+	} {
+		now := at(t, tc.at)
+		got := tc.ch.LastDigest(now)
+		if tc.digest == "" {
+			if !got.IsZero() {
+				t.Errorf("%s: LastDigest(%s) = %s, want zero", tc.name, tc.at, got)
+			}
+		} else if want := at(t, tc.digest); !got.Equal(want) {
+			t.Errorf("%s: LastDigest(%s) = %s, want %s", tc.name, tc.at, got.UTC(), want)
+		}
+		if got, want := tc.ch.LastSummary(now), at(t, tc.summary); !got.Equal(want) {
+			t.Errorf("%s: LastSummary(%s) = %s, want %s", tc.name, tc.at, got.UTC(), want)
+		}
+	}
+}
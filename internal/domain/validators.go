@@ -2,9 +2,16 @@ package domain
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 )
 
+// MaxPeriod bounds indicator periods. A series warms up from up to four
+// times its longest period in candles, read on first use and for every
+// sparkline.
+const MaxPeriod = 500
+
 func ValidateAlert(a *Alert) error {
 	if a.Symbol == "" {
 		return errors.New("symbol required")
@@ -12,11 +19,144 @@ func ValidateAlert(a *Alert) error {
 	if strings.ToUpper(a.Symbol) != a.Symbol {
 		return errors.New("symbol must be uppercase, e.g., BTCUSDT")
 	}
-	if a.Threshold <= 0 {
+	if a.Kind != KindArbitrage && (a.Exchange != "" || a.PairExchange != "") {
+		return errors.New("exchanges are only chosen for ARBITRAGE alerts")
+	}
+	if !a.Kind.Indicator() && (a.Interval != "" || a.Period != 0 || a.SlowPeriod != 0) {
+		return errors.New("interval and periods are only used by indicator alerts")
+	}
+	if a.PairSymbol != "" && a.Kind != KindRatio && a.Kind != KindSpread {
+		return errors.New("second symbol is only used by RATIO and SPREAD alerts")
+	}
+	if a.Expr != "" && a.Kind != KindPrice {
+		return errors.New("a condition can't be combined with a " + string(a.Kind) + " alert")
+	}
+	switch a.Kind {
+	case KindPrice, KindVolume, KindChange:
+	case KindHigh, KindLow:
+		if want := a.Kind.Direction(); a.Direction != want {
+			return fmt.Errorf("direction of %s alerts must be %s", a.Kind, want)
+		}
+	case KindRatio, KindSpread:
+		if a.PairSymbol == "" {
+			return errors.New("second symbol required for " + string(a.Kind) + " alerts")
+		}
+		if strings.ToUpper(a.PairSymbol) != a.PairSymbol {
+			return errors.New("second symbol must be uppercase, e.g., BTCUSDT")
+		}
+		if a.PairSymbol == a.Symbol {
+			return errors.New("second symbol must differ from the first")
+		}
+	case KindArbitrage:
+		if !knownExchange(a.Exchange) || !knownExchange(a.PairExchange) {
+			return fmt.Errorf("exchanges must be two of %s", strings.Join(Exchanges, ", "))
+		}
+		if a.Exchange == a.PairExchange {
+			return errors.New("second exchange must differ from the first")
+		}
+	case KindSMA, KindEMA, KindEMACross, KindRSI:
+		if a.Period < 2 {
+			return errors.New("period must be at least 2")
+		}
+		if a.Period > MaxPeriod || a.SlowPeriod > MaxPeriod {
+			return fmt.Errorf("periods must be at most %d", MaxPeriod)
+		}
+		if a.Kind == KindEMACross && a.SlowPeriod <= a.Period {
+			return errors.New("slow period must be longer than the fast one")
+		}
+		if a.Kind != KindEMACross && a.SlowPeriod != 0 {
+			return errors.New("slow period is only used by EMA_CROSS alerts")
+		}
+		if a.Kind == KindRSI && (a.Threshold <= 0 || a.Threshold >= 100) {
+			return errors.New("RSI level must be between 0 and 100")
+		}
+	default:
+		return errors.New("kind must be PRICE, RATIO, SPREAD, ARBITRAGE, SMA, EMA, EMA_CROSS, RSI, VOLUME, CHANGE_24H, HIGH_24H or LOW_24H")
+	}
+	if a.Expr != "" {
+		// The condition itself is checked by rules.Parse.
+		return ValidateSeverity(a.Severity)
+	}
+	// Spreads and 24h changes can be zero or negative; prices, ratios and
+	// volumes can't. Indicator levels were checked above, and the rest
+	// cross a moving line instead.
+	if a.Threshold <= 0 && a.HasThreshold() && a.Kind != KindSpread && a.Kind != KindChange && !a.Kind.Indicator() {
 		return errors.New("threshold must be > 0")
 	}
 	if a.Direction != DirectionUp && a.Direction != DirectionDown {
 		return errors.New("direction must be UP or DOWN")
 	}
+	return ValidateSeverity(a.Severity)
+}
+
+func knownExchange(name string) bool {
+	for _, e := range Exchanges {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateSeverity(s Severity) error {
+	if s != SeverityInfo && s != SeverityWarning && s != SeverityCritical {
+		return errors.New("severity must be INFO, WARNING or CRITICAL")
+	}
+	return nil
+}
+
+func ValidateSchedule(s Schedule) error {
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("unknown time zone %q", s.Timezone)
+		}
+	}
+	if _, err := clockMinutes(s.From); err != nil {
+		return err
+	}
+	if _, err := clockMinutes(s.To); err != nil {
+		return err
+	}
+	if s.Days != "" {
+		for _, d := range strings.Split(s.Days, ",") {
+			ok := false
+			for _, w := range weekdays {
+				ok = ok || strings.TrimSpace(d) == w
+			}
+			if !ok {
+				return fmt.Errorf("unknown day %q, use MON..SUN", d)
+			}
+		}
+	}
+	if s.QuietPolicy != QuietQueue && s.QuietPolicy != QuietDrop {
+		return errors.New("quiet policy must be QUEUE or DROP")
+	}
+	return nil
+}
+
+// ValidateChannel fills in defaults for the delivery settings of c and
+// checks them.
+func ValidateChannel(c *Channel) error {
+	if c.MinSeverity == "" {
+		c.MinSeverity = SeverityInfo
+	}
+	if err := ValidateSeverity(c.MinSeverity); err != nil {
+		return err
+	}
+	if c.Schedule.QuietPolicy == "" {
+		c.Schedule.QuietPolicy = QuietQueue
+	}
+	if err := ValidateSchedule(c.Schedule); err != nil {
+		return err
+	}
+	if c.Digest == "" {
+		c.Digest = DigestOff
+	}
+	if c.Digest != DigestOff && c.Digest != DigestHourly && c.Digest != DigestDaily {
+		return errors.New("digest must be OFF, HOURLY or DAILY")
+	}
+	if _, err := clockMinutes(c.DigestAt); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,28 @@
+package domain
+
+import "testing"
+
+func TestValidateAlertPeriods(t *testing.T) {
+	for _, tc := range []struct {
+		kind         AlertKind
+		period, slow int
+		ok           bool
+	}{
+		{KindSMA, 2, 0, true},
+		{KindSMA, 1, 0, false},
+		{KindEMA, MaxPeriod, 0, true},
+		{KindEMA, MaxPeriod + 1, 0, false},
+		{KindEMACross, 12, MaxPeriod, true},
+		{KindEMACross, 12, MaxPeriod + 1, false},
+		{KindEMACross, 26, 12, false},
+		{KindRSI, 100000, 0, false},
+	} {
+		al := Alert{
+			Kind: tc.kind, Symbol: "BTCUSDT", Interval: "1h", Period: tc.period, SlowPeriod: tc.slow,
+			Direction: DirectionUp, Threshold: 70, Severity: SeverityInfo,
+		}
+		if err := ValidateAlert(&al); (err == nil) != tc.ok {
+			t.Errorf("%s period %d slow %d: err = %v, want ok %v", tc.kind, tc.period, tc.slow, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package history aggregates price updates into OHLC candles stored in
+// SQLite, for charts, percent-change rules and backtests.
+package history
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+)
+
+type Interval struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Intervals are the candle sizes every update is aggregated into.
+var Intervals = []Interval{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+}
+
+func ParseInterval(name string) (Interval, error) {
+	for _, iv := range Intervals {
+		if iv.Name == name {
+			return iv, nil
+		}
+	}
+	return Interval{}, fmt.Errorf("unknown interval %q (want 1m, 5m or 1h)", name)
+}
+
+type key struct {
+	symbol   string
+	interval string
+}
+
+// openCandle is a candle still receiving updates. rev counts them and
+// flushed is the rev last written, so unchanged candles aren't rewritten.
+type openCandle struct {
+	domain.Candle
+	rev, flushed int
+}
+
+// Store keeps the open candle per symbol and interval in memory and writes
+// candles to the database on Flush.
+type Store struct {
+	db        *gorm.DB
+	retention map[string]time.Duration
+
+	mu   sync.Mutex
+	open map[key]*openCandle
+	// dirty holds closed candles not yet written, oldest first.
+	dirty map[key][]domain.Candle
+}
+
+// NewStore returns a store using retention per interval name, usually
+// config.CandleRetention. Candles of intervals missing from retention, or
+// with no positive retention, are kept forever.
+func NewStore(db *gorm.DB, retention map[string]time.Duration) *Store {
+	return &Store{db: db, retention: retention, open: map[key]*openCandle{}, dirty: map[key][]domain.Candle{}}
+}
+
+// Record adds a price observed at t to the open candle of every interval.
+func (s *Store) Record(symbol string, p float64, t time.Time) {
+	t = t.UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, iv := range Intervals {
+		k := key{symbol, iv.Name}
+		start := t.Truncate(iv.Duration)
+		c := s.open[k]
+		if c != nil && c.OpenTime.Equal(start) {
+			c.High = max(c.High, p)
+			c.Low = min(c.Low, p)
+			c.Close = p
+			c.Count++
+			c.rev++
+			continue
+		}
+		if c != nil && start.Before(c.OpenTime) {
+			continue // late update for a candle already closed
+		}
+		if c != nil && c.rev != c.flushed {
+			s.dirty[k] = append(s.dirty[k], c.Candle)
+		}
+		s.open[k] = &openCandle{Candle: domain.Candle{
+			Symbol: symbol, Interval: iv.Name, OpenTime: start,
+			Open: p, High: p, Low: p, Close: p, Count: 1,
+		}, rev: 1}
+	}
+}
+
+// Flush upserts closed candles and the open ones updated since the last
+// flush. Nothing is forgotten until the write succeeds, so a failed flush is
+// retried in full by the next one.
+func (s *Store) Flush() error {
+	type written struct {
+		openTime time.Time
+		rev      int
+	}
+	s.mu.Lock()
+	var rows []domain.Candle
+	closed := map[key]int{}
+	for k, cs := range s.dirty {
+		rows = append(rows, cs...)
+		closed[k] = len(cs)
+	}
+	open := map[key]written{}
+	for k, c := range s.open {
+		if c.rev != c.flushed {
+			rows = append(rows, c.Candle)
+			open[k] = written{c.OpenTime, c.rev}
+		}
+	}
+	s.mu.Unlock()
+
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := s.db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 200).Error; err != nil {
+		return err
+	}
+
+	// Records since the snapshot only appended closed candles or bumped revs,
+	// which stay to be written next time.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, n := range closed {
+		if rest := s.dirty[k][n:]; len(rest) > 0 {
+			s.dirty[k] = rest
+		} else {
+			delete(s.dirty, k)
+		}
+	}
+	for k, w := range open {
+		if c := s.open[k]; c != nil && c.OpenTime.Equal(w.openTime) {
+			c.flushed = w.rev
+		}
+	}
+	return nil
+}
+
+// Prune deletes candles older than their interval's retention.
+func (s *Store) Prune(now time.Time) error {
+	for name, keep := range s.retention {
+		if keep <= 0 {
+			continue
+		}
+		err := s.db.Where("interval = ? AND open_time < ?", name, now.Add(-keep).UTC()).Delete(&domain.Candle{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run flushes every flushEvery and prunes hourly until ctx is cancelled, then
+// flushes one last time.
+func (s *Store) Run(ctx context.Context, flushEvery time.Duration) {
+	flush := time.NewTicker(flushEvery)
+	defer flush.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				log.Error().Err(err).Msg("candle flush failed")
+			}
+			return
+		case <-flush.C:
+			if err := s.Flush(); err != nil {
+				log.Error().Err(err).Msg("candle flush failed")
+			}
+		case now := <-prune.C:
+			if err := s.Prune(now); err != nil {
+				log.Error().Err(err).Msg("candle prune failed")
+			}
+		}
+	}
+}
+
+// Candles returns up to limit candles for symbol and interval with an open
+// time in [from, to), oldest first. A zero from or to leaves that side open;
+// with no from, the most recent candles are returned. Candles not flushed
+// yet are read from memory, taking precedence over their stored rows.
+func (s *Store) Candles(symbol string, iv Interval, from, to time.Time, limit int) ([]domain.Candle, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	inRange := func(c domain.Candle) bool {
+		return (from.IsZero() || !c.OpenTime.Before(from)) && (to.IsZero() || c.OpenTime.Before(to))
+	}
+	k := key{symbol, iv.Name}
+	var buffered []domain.Candle
+	s.mu.Lock()
+	for _, c := range s.dirty[k] {
+		if inRange(c) {
+			buffered = append(buffered, c)
+		}
+	}
+	if c := s.open[k]; c != nil && inRange(c.Candle) {
+		buffered = append(buffered, c.Candle)
+	}
+	s.mu.Unlock()
+
+	stored, err := s.stored(symbol, iv, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffered) == 0 {
+		return stored, nil
+	}
+	byTime := map[int64]domain.Candle{}
+	for _, c := range stored {
+		byTime[c.OpenTime.UnixNano()] = c
+	}
+	for _, c := range buffered {
+		byTime[c.OpenTime.UnixNano()] = c
+	}
+	out := make([]domain.Candle, 0, len(byTime))
+	for _, c := range byTime {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].OpenTime.Before(out[j].OpenTime) })
+	if len(out) > limit {
+		if from.IsZero() {
+			out = out[len(out)-limit:]
+		} else {
+			out = out[:limit]
+		}
+	}
+	return out, nil
+}
+
+// stored is Candles over the database alone.
+func (s *Store) stored(symbol string, iv Interval, from, to time.Time, limit int) ([]domain.Candle, error) {
+	q := s.db.Where("symbol = ? AND interval = ?", symbol, iv.Name)
+	if !from.IsZero() {
+		q = q.Where("open_time >= ?", from.UTC())
+	}
+	if !to.IsZero() {
+		q = q.Where("open_time < ?", to.UTC())
+	}
+	var out []domain.Candle
+	if !from.IsZero() {
+		return out, q.Order("open_time asc").Limit(limit).Find(&out).Error
+	}
+	if err := q.Order("open_time desc").Limit(limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
@@ -0,0 +1,198 @@
+package history
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nuid"
+	"gorm.io/gorm"
+
+	"github.com/Secretstar513/crypto-alerts/internal/db"
+	"github.com/Secretstar513/crypto-alerts/internal/domain"
+)
+
+func newTestStore(t *testing.T, retention map[string]time.Duration) (*Store, *gorm.DB) {
+	t.Helper()
+	d := db.OpenSQLite(fmt.Sprintf("file:%s?mode=memory&cache=shared", nuid.Next()))
+	sqlDB, err := d.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := d.AutoMigrate(&domain.Candle{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(d, retention), d
+}
+
+func storedCandles(t *testing.T, d *gorm.DB, interval string) []domain.Candle {
+	t.Helper()
+	var out []domain.Candle
+	if err := d.Where("interval = ?", interval).Order("open_time asc").Find(&out).Error; err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRecordAggregatesIntervals(t *testing.T) {
+	s, d := newTestStore(t, nil)
+	t0 := time.Date(2026, 10, 19, 9, 58, 0, 0, time.UTC)
+	for _, u := range []struct {
+		at time.Duration
+		p  float64
+	}{
+		{0, 100},
+		{30 * time.Second, 105},
+		{90 * time.Second, 95},  // 09:59
+		{2 * time.Minute, 101},  // 10:00, a new 5m and 1h candle
+		{4 * time.Minute, 99},   // 10:02
+		{7 * time.Minute, 103},  // 10:05
+		{65 * time.Second, 200}, // late for the 09:59 candle, already closed
+	} {
+		s.Record("BTCUSDT", u.p, t0.Add(u.at))
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	type ohlc struct {
+		open       string
+		o, h, l, c float64
+		count      int
+	}
+	for _, tc := range []struct {
+		interval string
+		want     []ohlc
+	}{
+		{"1m", []ohlc{
+			{"09:58", 100, 105, 100, 105, 2},
+			{"09:59", 95, 95, 95, 95, 1},
+			{"10:00", 101, 101, 101, 101, 1},
+			{"10:02", 99, 99, 99, 99, 1},
+			{"10:05", 103, 103, 103, 103, 1},
+		}},
+		{"5m", []ohlc{
+			{"09:55", 100, 105, 95, 95, 3},
+			{"10:00", 101, 101, 99, 99, 2},
+			{"10:05", 103, 103, 103, 103, 1},
+		}},
+		{"1h", []ohlc{
+			{"09:00", 100, 105, 95, 95, 3},
+			{"10:00", 101, 103, 99, 103, 3},
+		}},
+	} {
+		got := storedCandles(t, d, tc.interval)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s: got %d candles, want %d: %+v", tc.interval, len(got), len(tc.want), got)
+		}
+		for i, w := range tc.want {
+			g := got[i]
+			if g.OpenTime.UTC().Format("15:04") != w.open || g.Open != w.o || g.High != w.h || g.Low != w.l || g.Close != w.c || g.Count != w.count {
+				t.Errorf("%s candle %d = %s O%g H%g L%g C%g n%d, want %+v", tc.interval, i,
+					g.OpenTime.UTC().Format("15:04"), g.Open, g.High, g.Low, g.Close, g.Count, w)
+			}
+		}
+	}
+}
+
+func TestFlushRetriesFailedWrites(t *testing.T) {
+	s, d := newTestStore(t, nil)
+	t0 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	s.Record("BTCUSDT", 100, t0)
+	s.Record("BTCUSDT", 101, t0.Add(time.Minute)) // closes the 10:00 1m candle
+
+	if err := d.Migrator().DropTable(&domain.Candle{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err == nil {
+		t.Fatal("Flush succeeded without a candles table")
+	}
+	if err := d.AutoMigrate(&domain.Candle{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedCandles(t, d, "1m"); len(got) != 2 {
+		t.Fatalf("got %d 1m candles after the retry, want 2: %+v", len(got), got)
+	}
+
+	// An open candle without new ticks isn't written again.
+	if err := d.Where("1 = 1").Delete(&domain.Candle{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedCandles(t, d, "1m"); len(got) != 0 {
+		t.Fatalf("unchanged candles rewritten: %+v", got)
+	}
+	s.Record("BTCUSDT", 102, t0.Add(time.Minute+time.Second))
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedCandles(t, d, "1m"); len(got) != 1 || got[0].Close != 102 {
+		t.Fatalf("updated open candle not written: %+v", got)
+	}
+}
+
+func TestCandlesReadsUnflushedWithoutWriting(t *testing.T) {
+	s, d := newTestStore(t, nil)
+	t0 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		s.Record("BTCUSDT", float64(100+i), t0.Add(time.Duration(i)*time.Minute))
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.Record("BTCUSDT", 110, t0.Add(2*time.Minute+time.Second)) // updates the flushed 10:02
+	s.Record("BTCUSDT", 120, t0.Add(3*time.Minute))
+
+	iv, _ := ParseInterval("1m")
+	got, err := s.Candles("BTCUSDT", iv, time.Time{}, time.Time{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var closes []float64
+	for _, c := range got {
+		closes = append(closes, c.Close)
+	}
+	if fmt.Sprint(closes) != "[101 110 120]" {
+		t.Fatalf("latest closes = %v, want [101 110 120]", closes)
+	}
+	got, err = s.Candles("BTCUSDT", iv, t0, t0.Add(2*time.Minute), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Close != 100 || got[1].Close != 101 {
+		t.Fatalf("range [10:00, 10:02) = %+v", got)
+	}
+	if stored := storedCandles(t, d, "1m"); len(stored) != 3 || stored[2].Close != 102 {
+		t.Fatalf("Candles wrote to the database: %+v", stored)
+	}
+}
+
+func TestPruneByRetention(t *testing.T) {
+	s, d := newTestStore(t, map[string]time.Duration{"1m": time.Hour, "5m": 14 * 24 * time.Hour, "1h": 0})
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	rows := []domain.Candle{
+		{Symbol: "BTCUSDT", Interval: "1m", OpenTime: now.Add(-2 * time.Hour)},
+		{Symbol: "BTCUSDT", Interval: "1m", OpenTime: now.Add(-30 * time.Minute)},
+		{Symbol: "BTCUSDT", Interval: "5m", OpenTime: now.Add(-15 * 24 * time.Hour)},
+		{Symbol: "BTCUSDT", Interval: "5m", OpenTime: now.Add(-13 * 24 * time.Hour)},
+		{Symbol: "BTCUSDT", Interval: "1h", OpenTime: now.Add(-1000 * 24 * time.Hour)},
+	}
+	if err := d.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Prune(now); err != nil {
+		t.Fatal(err)
+	}
+	for interval, want := range map[string]int{"1m": 1, "5m": 1, "1h": 1} {
+		if got := storedCandles(t, d, interval); len(got) != want {
+			t.Errorf("%s: %d candles left, want %d", interval, len(got), want)
+		}
+	}
+}
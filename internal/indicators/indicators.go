@@ -0,0 +1,138 @@
+// Package indicators computes technical indicators over a series of bar
+// closes incrementally: each closed bar updates the state in O(1), and the
+// value for the bar still forming can be read at any price without
+// committing it, so a live feed doesn't recompute the whole window per tick.
+package indicators
+
+import "math"
+
+// Indicator is fed the closes of finished bars in order. Peek returns the
+// value the indicator would have if the bar now forming closed at price; ok
+// is false until enough bars have closed.
+type Indicator interface {
+	Push(close float64)
+	Peek(price float64) (v float64, ok bool)
+}
+
+// SMA is the simple moving average of the last N closes, the forming bar
+// being the latest of them.
+type SMA struct {
+	n      int
+	ring   []float64
+	next   int
+	filled int
+	sum    float64
+}
+
+func NewSMA(n int) *SMA {
+	return &SMA{n: n, ring: make([]float64, n-1)}
+}
+
+func (s *SMA) Push(close float64) {
+	if len(s.ring) == 0 {
+		return
+	}
+	if s.filled == len(s.ring) {
+		s.sum -= s.ring[s.next]
+	} else {
+		s.filled++
+	}
+	s.ring[s.next] = close
+	s.sum += close
+	s.next = (s.next + 1) % len(s.ring)
+}
+
+func (s *SMA) Peek(price float64) (float64, bool) {
+	if s.filled < len(s.ring) {
+		return 0, false
+	}
+	return (s.sum + price) / float64(s.n), true
+}
+
+// EMA is the exponential moving average over N periods, seeded with the
+// simple average of the first N closes.
+type EMA struct {
+	n     int
+	alpha float64
+	count int
+	value float64
+}
+
+func NewEMA(n int) *EMA {
+	return &EMA{n: n, alpha: 2 / float64(n+1)}
+}
+
+func (e *EMA) Push(close float64) {
+	e.count++
+	switch {
+	case e.count < e.n:
+		e.value += close
+	case e.count == e.n:
+		e.value = (e.value + close) / float64(e.n)
+	default:
+		e.value += e.alpha * (close - e.value)
+	}
+}
+
+func (e *EMA) Peek(price float64) (float64, bool) {
+	if e.count < e.n {
+		return 0, false
+	}
+	return e.value + e.alpha*(price-e.value), true
+}
+
+// RSI is Wilder's relative strength index over N periods, from 0 (only
+// losses) to 100 (only gains). It is seeded with the average gain and loss
+// of the first N changes.
+type RSI struct {
+	n       int
+	count   int // changes seen
+	prev    float64
+	started bool
+	avgGain float64
+	avgLoss float64
+}
+
+func NewRSI(n int) *RSI {
+	return &RSI{n: n}
+}
+
+func (r *RSI) Push(close float64) {
+	if !r.started {
+		r.prev, r.started = close, true
+		return
+	}
+	gain, loss := split(close - r.prev)
+	r.prev = close
+	r.count++
+	switch {
+	case r.count <= r.n:
+		r.avgGain += gain / float64(r.n)
+		r.avgLoss += loss / float64(r.n)
+	default:
+		r.avgGain, r.avgLoss = r.smooth(gain, loss)
+	}
+}
+
+func (r *RSI) Peek(price float64) (float64, bool) {
+	if r.count < r.n {
+		return 0, false
+	}
+	g, l := r.smooth(split(price - r.prev))
+	if l == 0 {
+		if g == 0 {
+			return 50, true
+		}
+		return 100, true
+	}
+	return 100 - 100/(1+g/l), true
+}
+
+func (r *RSI) smooth(gain, loss float64) (float64, float64) {
+	k := float64(r.n - 1)
+	return (r.avgGain*k + gain) / float64(r.n), (r.avgLoss*k + loss) / float64(r.n)
+}
+
+func split(change float64) (gain, loss float64) {
+	return math.Max(change, 0), math.Max(-change, 0)
+}
@@ -0,0 +1,106 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+// Reference series and values from StockCharts' worked examples for moving
+// averages (10 periods) and RSI (14 periods).
+var (
+	maCloses = []float64{
+		22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+		22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+		23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+	}
+	rsiCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+		46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+		43.42, 42.66, 43.13,
+	}
+)
+
+// check feeds closes to ind one bar at a time, peeking at each close before
+// pushing it, and compares the readings from bar first on with want.
+func check(t *testing.T, ind Indicator, closes []float64, first int, want []float64, tolerance float64) {
+	t.Helper()
+	for i, c := range closes {
+		v, ok := ind.Peek(c)
+		if i < first {
+			if ok {
+				t.Fatalf("bar %d: ready before bar %d", i, first)
+			}
+		} else {
+			if !ok {
+				t.Fatalf("bar %d: not ready", i)
+			}
+			if w := want[i-first]; math.Abs(v-w) > tolerance {
+				t.Errorf("bar %d: got %.4f, want %.2f", i, v, w)
+			}
+			// Peeking doesn't commit the forming bar.
+			if again, _ := ind.Peek(c); again != v {
+				t.Fatalf("bar %d: second Peek = %v, want %v", i, again, v)
+			}
+		}
+		ind.Push(c)
+	}
+}
+
+func TestSMA(t *testing.T) {
+	// The forming bar is the 10th close, so the first average is ready
+	// with nine closed bars.
+	check(t, NewSMA(10), maCloses, 9, []float64{
+		22.22, 22.21, 22.23, 22.26, 22.31, 22.42, 22.61, 22.77, 22.91, 23.08, 23.21,
+		23.38, 23.53, 23.65, 23.71, 23.69, 23.61, 23.51, 23.43, 23.28, 23.13,
+	}, 0.01)
+}
+
+func TestSMAOfOne(t *testing.T) {
+	s := NewSMA(1)
+	for _, c := range []float64{3, 5, 4} {
+		if v, ok := s.Peek(c); !ok || v != c {
+			t.Fatalf("Peek(%v) = %v, %v", c, v, ok)
+		}
+		s.Push(c)
+	}
+}
+
+func TestEMA(t *testing.T) {
+	// Seeded with the simple average of the first 10 closes (22.22), then
+	// smoothed from the 11th on.
+	check(t, NewEMA(10), maCloses, 10, []float64{
+		22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28, 23.34,
+		23.43, 23.51, 23.54, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08, 22.92,
+	}, 0.01)
+}
+
+func TestRSI(t *testing.T) {
+	// The first 14 changes seed Wilder's averages; every reading after
+	// that smooths in one more change. StockCharts rounds its intermediate
+	// averages, hence the looser tolerance.
+	check(t, NewRSI(14), rsiCloses, 15, []float64{
+		66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38, 54.71,
+		50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77,
+	}, 0.1)
+}
+
+func TestRSIBounds(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		closes []float64
+		want   float64
+	}{
+		{"only gains", []float64{1, 2, 3, 4}, 100},
+		{"only losses", []float64{4, 3, 2, 1}, 0},
+		{"flat", []float64{2, 2, 2, 2}, 50},
+	} {
+		r := NewRSI(2)
+		for _, c := range tc.closes[:3] {
+			r.Push(c)
+		}
+		if v, ok := r.Peek(tc.closes[3]); !ok || v != tc.want {
+			t.Errorf("%s: Peek = %v, %v, want %v", tc.name, v, ok, tc.want)
+		}
+	}
+}
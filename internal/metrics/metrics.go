@@ -0,0 +1,68 @@
+// Package metrics holds the Prometheus collectors the engine reports to. They
+// are registered with the default registry, served on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "crypto_alerts"
+
+var (
+	PriceUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "price_updates_total",
+		Help:      "Price updates received from the feeds, by exchange, symbol and transport.",
+	}, []string{"exchange", "symbol", "transport"})
+
+	DroppedUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "price_updates_dropped_total",
+		Help:      "Price updates dropped because a subscriber's buffer was full.",
+	}, []string{"exchange", "symbol"})
+
+	LastUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "price_last_update_timestamp_seconds",
+		Help:      "Unix time of the last price update, by exchange and symbol.",
+	}, []string{"exchange", "symbol"})
+
+	WSReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ws_reconnects_total",
+		Help:      "WebSocket stream connection attempts after the first, by exchange and symbol.",
+	}, []string{"exchange", "symbol"})
+
+	UpdateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "engine_update_duration_seconds",
+		Help:      "Time the engine spends on one price update, including rule evaluation and delivery.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	})
+
+	RuleEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_evaluations_total",
+		Help:      "Alert rules evaluated against a price update, by symbol and alert kind.",
+	}, []string{"symbol", "kind"})
+
+	AlertsFired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_fired_total",
+		Help:      "Alerts whose condition was met, by symbol, alert kind and severity.",
+	}, []string{"symbol", "kind", "severity"})
+
+	Notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Notification outcomes (sent, failed, not_configured, queued, dropped), by channel.",
+	}, []string{"channel", "outcome"})
+
+	NotifyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "notification_duration_seconds",
+		Help:      "Time taken to hand a notification to the channel, by channel.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"channel"})
+)
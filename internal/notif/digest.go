@@ -0,0 +1,61 @@
+package notif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Digest bundles several events into a single message. Summary lines, such
+// as daily open/high/low/close figures, follow the events.
+type Digest struct {
+	Title   string
+	Events  []Event
+	Summary []string
+}
+
+// DigestNotifier is implemented by notifiers that can deliver a Digest as one
+// message instead of one message per event.
+type DigestNotifier interface {
+	NotifyDigest(ctx context.Context, d Digest) error
+}
+
+// SendDigest delivers d through n, falling back to one Notify per event when n
+// can't batch.
+func SendDigest(ctx context.Context, n Notifier, d Digest) error {
+	if dn, ok := n.(DigestNotifier); ok {
+		return dn.NotifyDigest(ctx, d)
+	}
+	var errs []error
+	for _, ev := range d.Events {
+		if err := n.Notify(ctx, ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Lines renders one plain-text line per event, then the summary lines.
+func (d Digest) Lines() []string {
+	out := make([]string, 0, len(d.Events))
+	for _, ev := range d.Events {
+		line := fmt.Sprintf("%s %s @ %.8f (thr %.8f)", ev.Symbol, ev.Direction, ev.Price, ev.Threshold)
+		if ev.Condition != "" {
+			line = fmt.Sprintf("%s @ %.8f: %s", ev.Symbol, ev.Price, ev.Condition)
+		}
+		if ev.Severity != "" {
+			line += " [" + ev.Severity + "]"
+		}
+		if !ev.Time.IsZero() {
+			line = ev.Time.UTC().Format("2006-01-02 15:04Z") + " " + line
+		}
+		out = append(out, line)
+	}
+	return append(out, d.Summary...)
+}
+
+// Text renders the title followed by the event lines.
+func (d Digest) Text() string {
+	return d.Title + "\n" + strings.Join(d.Lines(), "\n")
+}
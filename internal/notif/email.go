@@ -2,7 +2,6 @@ package notif
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
 	"net/smtp"
@@ -32,14 +31,45 @@ func (n *EmailNotifier) Name() string  { return "email" }
 func (n *EmailNotifier) Enabled() bool { return n.enabled }
 
 func (n *EmailNotifier) Notify(ctx context.Context, ev Event) error {
-	if !n.enabled { return nil }
+	if !n.enabled {
+		return nil
+	}
 	if n.cfg.Host == "" || n.cfg.Port == "" || n.cfg.From == "" || n.cfg.To == "" {
+		return ErrNotConfigured
+	}
+	tag := "[Crypto Alert]"
+	if ev.Severity != "" {
+		tag += "[" + ev.Severity + "]"
+	}
+	if ev.Test {
+		tag += "[TEST]"
+	}
+	sub := fmt.Sprintf("%s %s %s %.2f (thr=%.2f)", tag, ev.Symbol, ev.Direction, ev.Price, ev.Threshold)
+	at := ev.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	body := fmt.Sprintf("Symbol: %s\nDirection: %s\nSeverity: %s\nPrice: %.8f\nThreshold: %.8f\nTime: %s\n",
+		ev.Symbol, ev.Direction, ev.Severity, ev.Price, ev.Threshold, at.Format(time.RFC3339))
+	if ev.Condition != "" {
+		sub = fmt.Sprintf("%s %s (%s %.2f)", tag, ev.Condition, ev.Symbol, ev.Price)
+		body = fmt.Sprintf("Condition: %s\nSymbol: %s\nSeverity: %s\nPrice: %.8f\nTime: %s\n",
+			ev.Condition, ev.Symbol, ev.Severity, ev.Price, at.Format(time.RFC3339))
+	}
+	return n.send(sub, body)
+}
+
+func (n *EmailNotifier) NotifyDigest(ctx context.Context, d Digest) error {
+	if !n.enabled {
 		return nil
 	}
-	sub := fmt.Sprintf("[Crypto Alert] %s %s %.2f (thr=%.2f)", ev.Symbol, ev.Direction, ev.Price, ev.Threshold)
-	body := fmt.Sprintf("Symbol: %s\nDirection: %s\nPrice: %.8f\nThreshold: %.8f\nTime: %s\n",
-		ev.Symbol, ev.Direction, ev.Price, ev.Threshold, time.Now().Format(time.RFC3339))
+	if n.cfg.Host == "" || n.cfg.Port == "" || n.cfg.From == "" || n.cfg.To == "" {
+		return ErrNotConfigured
+	}
+	return n.send("[Crypto Alert] "+d.Title, strings.Join(d.Lines(), "\n")+"\n")
+}
 
+func (n *EmailNotifier) send(sub, body string) error {
 	addr := net.JoinHostPort(n.cfg.Host, n.cfg.Port)
 	msg := strings.Builder{}
 	msg.WriteString("From: " + n.cfg.From + "\r\n")
@@ -54,10 +84,5 @@ func (n *EmailNotifier) Notify(ctx context.Context, ev Event) error {
 		auth = smtp.PlainAuth("", n.cfg.User, n.cfg.Pass, n.cfg.Host)
 	}
 
-	_ = smtp.SendMail(addr, auth, n.cfg.From, []string{n.cfg.To}, []byte(msg.String()))
-	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
-	if err == nil {
-		_ = conn.Close()
-	}
-	return nil
+	return smtp.SendMail(addr, auth, n.cfg.From, []string{n.cfg.To}, []byte(msg.String()))
 }
@@ -13,13 +13,30 @@ func (n *LogNotifier) Name() string    { return "log" }
 func (n *LogNotifier) Enabled() bool   { return n.enabled }
 
 func (n *LogNotifier) Notify(ctx context.Context, ev Event) error {
-	if !n.enabled { return nil }
+	if !n.enabled {
+		return nil
+	}
 	log.Info().
 		Str("notifier", "log").
 		Str("symbol", ev.Symbol).
 		Float64("price", ev.Price).
 		Float64("threshold", ev.Threshold).
 		Str("direction", ev.Direction).
+		Str("condition", ev.Condition).
+		Str("severity", ev.Severity).
+		Bool("test", ev.Test).
 		Msg("ALERT")
 	return nil
 }
+
+func (n *LogNotifier) NotifyDigest(ctx context.Context, d Digest) error {
+	if !n.enabled {
+		return nil
+	}
+	log.Info().
+		Str("notifier", "log").
+		Int("events", len(d.Events)).
+		Strs("lines", d.Lines()).
+		Msg(d.Title)
+	return nil
+}
@@ -1,12 +1,27 @@
 package notif
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotConfigured is returned by Notify when a channel lacks the settings it
+// needs to deliver (SMTP host, bot token, ...).
+var ErrNotConfigured = errors.New("channel not configured")
 
 type Event struct {
 	Symbol    string
 	Price     float64
 	Threshold float64
 	Direction string
+	// Condition is the expression of a compound alert, which has no single
+	// threshold or direction; Symbol and Price are then the update that made
+	// it true.
+	Condition string
+	Severity  string
+	Time      time.Time
+	Test      bool
 }
 
 type Notifier interface {
@@ -2,30 +2,132 @@ package notif
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"net/url"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/Secretstar513/crypto-alerts/internal/telegram"
 )
 
+// TelegramConfig is stored as the TELEGRAM channel config. ChatID accepts a
+// comma-separated list; a "chat:thread" entry targets a forum topic.
+type TelegramConfig struct {
+	APIURL    string `json:"apiURL,omitempty"`
+	BotToken  string `json:"botToken"`
+	ChatID    string `json:"chatID"`
+	ParseMode string `json:"parseMode,omitempty"`
+}
+
 type TelegramNotifier struct {
-	botToken string
-	chatID   string
-	enabled  bool
+	cfg     TelegramConfig
+	client  *telegram.Client
+	targets []telegram.Target
+	// badTargets is why ChatID didn't parse; sends fail with it.
+	badTargets error
+	enabled    bool
 }
 
-func NewTelegram(botToken, chatID string, enabled bool) *TelegramNotifier {
-	return &TelegramNotifier{botToken: botToken, chatID: chatID, enabled: enabled}
+func NewTelegram(cfg TelegramConfig, enabled bool) *TelegramNotifier {
+	targets, err := telegram.ParseTargets(cfg.ChatID)
+	return &TelegramNotifier{
+		cfg:        cfg,
+		client:     telegram.NewClient(cfg.APIURL, cfg.BotToken),
+		targets:    targets,
+		badTargets: err,
+		enabled:    enabled,
+	}
 }
 func (n *TelegramNotifier) Name() string  { return "telegram" }
 func (n *TelegramNotifier) Enabled() bool { return n.enabled }
 
+// Notify sends ev to every configured chat. Telegram API errors, including
+// rate limits (*telegram.APIError with RetryAfter), are returned joined.
 func (n *TelegramNotifier) Notify(ctx context.Context, ev Event) error {
-	if !n.enabled || n.botToken == "" || n.chatID == "" {
+	if !n.enabled {
 		return nil
 	}
-	text := url.QueryEscape(fmt.Sprintf("ALERT %s %s @ %.8f (thr %.8f)", ev.Symbol, ev.Direction, ev.Price, ev.Threshold))
-	api := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage?chat_id=%s&text=%s", n.botToken, n.chatID, text)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, api, nil)
-	_, _ = http.DefaultClient.Do(req)
-	return nil
+	if n.badTargets != nil {
+		return n.badTargets
+	}
+	if n.cfg.BotToken == "" || len(n.targets) == 0 {
+		return ErrNotConfigured
+	}
+	return n.send(ctx, formatTelegram(ev, n.cfg.ParseMode))
+}
+
+func (n *TelegramNotifier) NotifyDigest(ctx context.Context, d Digest) error {
+	if !n.enabled {
+		return nil
+	}
+	if n.badTargets != nil {
+		return n.badTargets
+	}
+	if n.cfg.BotToken == "" || len(n.targets) == 0 {
+		return ErrNotConfigured
+	}
+	text := d.Text()
+	switch n.cfg.ParseMode {
+	case telegram.ParseModeMarkdownV2:
+		text = "*" + telegram.EscapeMarkdownV2(d.Title) + "*\n" + telegram.EscapeMarkdownV2(strings.Join(d.Lines(), "\n"))
+	case telegram.ParseModeHTML:
+		text = "<b>" + html.EscapeString(d.Title) + "</b>\n" + html.EscapeString(strings.Join(d.Lines(), "\n"))
+	}
+	return n.send(ctx, text)
+}
+
+func (n *TelegramNotifier) send(ctx context.Context, text string) error {
+	var errs []error
+	for _, t := range n.targets {
+		err := n.client.Send(ctx, telegram.OutgoingMessage{
+			ChatID:          t.ChatID,
+			MessageThreadID: t.ThreadID,
+			Text:            text,
+			ParseMode:       n.cfg.ParseMode,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", t.ChatID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func formatTelegram(ev Event, mode string) string {
+	price := strconv.FormatFloat(ev.Price, 'f', 8, 64)
+	thr := strconv.FormatFloat(ev.Threshold, 'f', 8, 64)
+	title := "ALERT"
+	if ev.Severity != "" {
+		title = ev.Severity + " " + title
+	}
+	if ev.Test {
+		title = "TEST " + title
+	}
+	if ev.Condition != "" {
+		return formatTelegramCondition(title, price, ev, mode)
+	}
+	switch mode {
+	case telegram.ParseModeMarkdownV2:
+		esc := telegram.EscapeMarkdownV2
+		return fmt.Sprintf("*%s* `%s` %s @ `%s` \\(thr `%s`\\)",
+			title, esc(ev.Symbol), esc(ev.Direction), esc(price), esc(thr))
+	case telegram.ParseModeHTML:
+		return fmt.Sprintf("<b>%s</b> <code>%s</code> %s @ <code>%s</code> (thr <code>%s</code>)",
+			title, html.EscapeString(ev.Symbol), html.EscapeString(ev.Direction), price, thr)
+	default:
+		return fmt.Sprintf("%s %s %s @ %s (thr %s)", title, ev.Symbol, ev.Direction, price, thr)
+	}
+}
+
+func formatTelegramCondition(title, price string, ev Event, mode string) string {
+	switch mode {
+	case telegram.ParseModeMarkdownV2:
+		esc := telegram.EscapeMarkdownV2
+		return fmt.Sprintf("*%s* `%s`\n%s @ `%s`", title, esc(ev.Condition), esc(ev.Symbol), esc(price))
+	case telegram.ParseModeHTML:
+		return fmt.Sprintf("<b>%s</b> <code>%s</code>\n%s @ <code>%s</code>",
+			title, html.EscapeString(ev.Condition), html.EscapeString(ev.Symbol), price)
+	default:
+		return fmt.Sprintf("%s %s\n%s @ %s", title, ev.Condition, ev.Symbol, price)
+	}
 }
@@ -0,0 +1,111 @@
+package notif
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Secretstar513/crypto-alerts/internal/telegram"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram/telegramtest"
+)
+
+func TestFormatTelegram(t *testing.T) {
+	cross := Event{Symbol: "BTCUSDT", Price: 65000.5, Threshold: 65000, Direction: "UP", Severity: "CRITICAL"}
+	cond := Event{Symbol: "SOL_USDT", Price: 201, Condition: "SOL_USDT crosses up 200 while BTCUSDT > 65000", Severity: "INFO", Test: true}
+	for _, tc := range []struct {
+		ev   Event
+		mode string
+		want string
+	}{
+		{cross, "", "CRITICAL ALERT BTCUSDT UP @ 65000.50000000 (thr 65000.00000000)"},
+		{cross, telegram.ParseModeMarkdownV2, "*CRITICAL ALERT* `BTCUSDT` UP @ `65000\\.50000000` \\(thr `65000\\.00000000`\\)"},
+		{cross, telegram.ParseModeHTML, "<b>CRITICAL ALERT</b> <code>BTCUSDT</code> UP @ <code>65000.50000000</code> (thr <code>65000.00000000</code>)"},
+		{cond, "", "TEST INFO ALERT SOL_USDT crosses up 200 while BTCUSDT > 65000\nSOL_USDT @ 201.00000000"},
+		{cond, telegram.ParseModeMarkdownV2, "*TEST INFO ALERT* `SOL\\_USDT crosses up 200 while BTCUSDT \\> 65000`\nSOL\\_USDT @ `201\\.00000000`"},
+		{cond, telegram.ParseModeHTML, "<b>TEST INFO ALERT</b> <code>SOL_USDT crosses up 200 while BTCUSDT &gt; 65000</code>\nSOL_USDT @ <code>201.00000000</code>"},
+	} {
+		if got := formatTelegram(tc.ev, tc.mode); got != tc.want {
+			t.Errorf("formatTelegram(%s, %q) =\n%s\nwant\n%s", tc.ev.Symbol, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestTelegramDigestEscaping(t *testing.T) {
+	d := Digest{
+		Title:   "Digest <1h>",
+		Events:  []Event{{Symbol: "ETHUSDT", Price: 3000, Condition: "ETHUSDT < 3000.5", Time: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)}},
+		Summary: []string{"BTC_USDT o 1 h 2"},
+	}
+	for mode, want := range map[string]string{
+		"":                           "Digest <1h>\n2026-10-19 09:00Z ETHUSDT @ 3000.00000000: ETHUSDT < 3000.5\nBTC_USDT o 1 h 2",
+		telegram.ParseModeMarkdownV2: "*Digest <1h\\>*\n2026\\-10\\-19 09:00Z ETHUSDT @ 3000\\.00000000: ETHUSDT < 3000\\.5\nBTC\\_USDT o 1 h 2",
+		telegram.ParseModeHTML:       "<b>Digest &lt;1h&gt;</b>\n2026-10-19 09:00Z ETHUSDT @ 3000.00000000: ETHUSDT &lt; 3000.5\nBTC_USDT o 1 h 2",
+	} {
+		tg := telegramtest.NewServer()
+		n := NewTelegram(TelegramConfig{APIURL: tg.URL, BotToken: "123:TOKEN", ChatID: "42", ParseMode: mode}, true)
+		if err := n.NotifyDigest(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		sent := tg.Sent()
+		tg.Close()
+		if len(sent) != 1 || sent[0].Body["text"] != want || (mode != "" && sent[0].Body["parse_mode"] != mode) {
+			t.Errorf("mode %q: sent %v, want text\n%s", mode, sent, want)
+		}
+	}
+}
+
+func TestTelegramTargets(t *testing.T) {
+	tg := telegramtest.NewServer()
+	t.Cleanup(tg.Close)
+	n := NewTelegram(TelegramConfig{APIURL: tg.URL, BotToken: "123:TOKEN", ChatID: "42, -1001:7"}, true)
+
+	if err := n.Notify(context.Background(), Event{Symbol: "BTCUSDT"}); err != nil {
+		t.Fatal(err)
+	}
+	sent := tg.Sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d messages, want one per target", len(sent))
+	}
+	if b := sent[0].Body; b["chat_id"] != "42" || b["message_thread_id"] != nil {
+		t.Errorf("first message went to %v", b)
+	}
+	if b := sent[1].Body; b["chat_id"] != "-1001" || b["message_thread_id"] != float64(7) {
+		t.Errorf("second message went to %v", b)
+	}
+
+	// A rate-limited chat is reported to the caller with its retry delay;
+	// the other chat still gets the message.
+	tg.FailNext(429, "Too Many Requests: retry after 12", 12)
+	err := n.Notify(context.Background(), Event{Symbol: "ETHUSDT"})
+	var apiErr *telegram.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 429 || apiErr.RetryAfter != 12*time.Second {
+		t.Fatalf("Notify = %v, want a 429 with retry after 12s", err)
+	}
+	if sent = tg.Sent(); len(sent) != 3 || sent[2].Body["chat_id"] != "-1001" {
+		t.Fatalf("sent %v, want the second chat served after the first failed", sent)
+	}
+}
+
+func TestTelegramNotConfigured(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  TelegramConfig
+		want error
+	}{
+		{"no token", TelegramConfig{ChatID: "42"}, ErrNotConfigured},
+		{"no chat", TelegramConfig{BotToken: "123:TOKEN", ChatID: " , "}, ErrNotConfigured},
+	} {
+		n := NewTelegram(tc.cfg, true)
+		if err := n.Notify(context.Background(), Event{}); !errors.Is(err, tc.want) {
+			t.Errorf("%s: Notify = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	n := NewTelegram(TelegramConfig{BotToken: "123:TOKEN", ChatID: "42:general"}, true)
+	if err := n.Notify(context.Background(), Event{}); err == nil || errors.Is(err, ErrNotConfigured) {
+		t.Errorf("bad thread: Notify = %v, want a parse error", err)
+	}
+	if err := NewTelegram(TelegramConfig{}, false).Notify(context.Background(), Event{}); err != nil {
+		t.Errorf("disabled: Notify = %v, want nil", err)
+	}
+}
@@ -4,16 +4,46 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"nhooyr.io/websocket"
 )
 
+// binanceTicker is the 24hr ticker stream message.
 type binanceTicker struct {
-	C string `json:"c"`
+	Close       string `json:"c"`
+	High        string `json:"h"`
+	Low         string `json:"l"`
+	Volume      string `json:"v"`
+	QuoteVolume string `json:"q"`
+	Change      string `json:"P"`
 }
 
-func wsURL(symbol string) string {
-	return fmt.Sprintf("wss://stream.binance.com:9443/ws/%s@ticker", lower(symbol))
+// stats parses the 24h fields, which are all missing from messages that
+// only carry a price.
+func (t binanceTicker) stats() (*Stats, error) {
+	if t.High == "" {
+		return nil, nil
+	}
+	var s Stats
+	for _, f := range []struct {
+		src string
+		dst *float64
+	}{
+		{t.High, &s.High}, {t.Low, &s.Low}, {t.Volume, &s.Volume},
+		{t.QuoteVolume, &s.QuoteVolume}, {t.Change, &s.ChangePercent},
+	} {
+		v, err := parseFloat(f.src)
+		if err != nil {
+			return nil, err
+		}
+		*f.dst = v
+	}
+	return &s, nil
+}
+
+func (f *BinanceFeed) wsURL(symbol string) string {
+	return fmt.Sprintf("%s/ws/%s@ticker", f.WSURL, lower(symbol))
 }
 func lower(s string) string {
 	b := []byte(s)
@@ -25,30 +55,38 @@ func lower(s string) string {
 	return string(b)
 }
 
-func streamBinance(ctx context.Context, symbol string, out chan<- float64) error {
-	c, _, err := websocket.Dial(ctx, wsURL(symbol), nil)
+// stream relays ticker messages until the connection fails. live is called on
+// the first price received, once the stream is known to work.
+func (f *BinanceFeed) stream(ctx context.Context, symbol string, out chan<- Update, live func()) error {
+	c, _, err := websocket.Dial(ctx, f.wsURL(symbol), &websocket.DialOptions{HTTPClient: f.HTTP})
 	if err != nil {
 		return err
 	}
 	defer c.Close(websocket.StatusNormalClosure, "bye")
 
-	for {
+	for first := true; ; {
 		_, data, err := c.Read(ctx)
 		if err != nil {
 			return err
 		}
-		var raw map[string]any
-		if err := json.Unmarshal(data, &raw); err != nil {
+		var t binanceTicker
+		if err := json.Unmarshal(data, &t); err != nil || t.Close == "" {
 			continue
 		}
-		if cval, ok := raw["c"].(string); ok {
-			if p, err := parseFloat(cval); err == nil {
-				select {
-				case out <- p:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
+		p, err := parseFloat(t.Close)
+		if err != nil {
+			continue
+		}
+		// A garbled 24h window still leaves a usable price.
+		stats, _ := t.stats()
+		if first {
+			live()
+			first = false
+		}
+		select {
+		case out <- Update{Symbol: symbol, Price: p, Time: time.Now(), Transport: TransportWS, Stats: stats}:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
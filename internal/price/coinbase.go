@@ -0,0 +1,132 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// CoinbaseFeed streams the Coinbase Exchange ticker channel, with the same
+// stream-then-poll failover as BinanceFeed. Symbols are given in Binance
+// form (BTCUSDT) and mapped to Coinbase products (BTC-USDT).
+type CoinbaseFeed struct {
+	WSURL         string
+	RESTURL       string
+	PollInterval  time.Duration
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	HTTP          *http.Client
+}
+
+// coinbaseQuotes are the quote assets CoinbaseProduct splits symbols on,
+// longest first so USDT wins over USD.
+var coinbaseQuotes = []string{"USDT", "USDC", "EUR", "GBP", "USD", "BTC", "ETH"}
+
+// CoinbaseProduct maps a Binance-style symbol to a Coinbase product ID,
+// e.g. BTCUSDT → BTC-USDT. Symbols with no known quote asset are returned
+// unchanged.
+func CoinbaseProduct(symbol string) string {
+	for _, q := range coinbaseQuotes {
+		if base, ok := strings.CutSuffix(symbol, q); ok && base != "" {
+			return base + "-" + q
+		}
+	}
+	return symbol
+}
+
+func (f *CoinbaseFeed) Run(ctx context.Context, symbol string, out chan<- Update, report Reporter) error {
+	return failover{
+		exchange:      ExchangeCoinbase,
+		pollInterval:  f.PollInterval,
+		retryDelay:    f.RetryDelay,
+		maxRetryDelay: f.MaxRetryDelay,
+		stream:        f.stream,
+		fetch: func(ctx context.Context, symbol string) (float64, *Stats, error) {
+			p, err := f.FetchPrice(ctx, symbol)
+			return p, nil, err
+		},
+	}.run(ctx, symbol, out, report)
+}
+
+type coinbaseTicker struct {
+	Type      string `json:"type"`
+	ProductID string `json:"product_id"`
+	Price     string `json:"price"`
+	Message   string `json:"message"`
+}
+
+// stream subscribes to symbol's ticker and relays prices until the
+// connection fails. live is called on the first price received.
+func (f *CoinbaseFeed) stream(ctx context.Context, symbol string, out chan<- Update, live func()) error {
+	c, _, err := websocket.Dial(ctx, f.WSURL, &websocket.DialOptions{HTTPClient: f.HTTP})
+	if err != nil {
+		return err
+	}
+	defer c.Close(websocket.StatusNormalClosure, "bye")
+
+	product := CoinbaseProduct(symbol)
+	sub, _ := json.Marshal(map[string]any{
+		"type":        "subscribe",
+		"product_ids": []string{product},
+		"channels":    []string{"ticker"},
+	})
+	if err := c.Write(ctx, websocket.MessageText, sub); err != nil {
+		return err
+	}
+
+	for first := true; ; {
+		_, data, err := c.Read(ctx)
+		if err != nil {
+			return err
+		}
+		var t coinbaseTicker
+		if err := json.Unmarshal(data, &t); err != nil {
+			continue
+		}
+		if t.Type == "error" {
+			return fmt.Errorf("coinbase %s: %s", product, t.Message)
+		}
+		if t.Type != "ticker" || t.ProductID != product {
+			continue
+		}
+		if p, err := parseFloat(t.Price); err == nil {
+			if first {
+				live()
+				first = false
+			}
+			select {
+			case out <- Update{Symbol: symbol, Price: p, Time: time.Now(), Transport: TransportWS}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// FetchPrice returns the current ticker price for symbol from f.RESTURL.
+func (f *CoinbaseFeed) FetchPrice(ctx context.Context, symbol string) (float64, error) {
+	product := CoinbaseProduct(symbol)
+	url := fmt.Sprintf("%s/products/%s/ticker", f.RESTURL, product)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := f.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("coinbase ticker %s: %s", product, resp.Status)
+	}
+	var v httpTicker
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return 0, err
+	}
+	return parseFloat(v.Price)
+}
@@ -0,0 +1,87 @@
+package price
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
+)
+
+// Feed produces price updates for one symbol into out until ctx is cancelled
+// or the source is exhausted, reporting state changes to report.
+type Feed interface {
+	Run(ctx context.Context, symbol string, out chan<- Update, report Reporter) error
+}
+
+// Exchanges with a live feed. Binance is the primary one and drives every
+// alert kind; the others only feed cross-exchange comparisons.
+const (
+	ExchangeBinance  = "binance"
+	ExchangeCoinbase = "coinbase"
+)
+
+// BinanceFeed streams the Binance 24hr ticker over WebSocket. When the stream
+// fails it polls the REST API while waiting to retry the stream, with the
+// wait growing from RetryDelay to MaxRetryDelay until a stream delivers again.
+type BinanceFeed struct {
+	WSURL         string
+	RESTURL       string
+	PollInterval  time.Duration
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	HTTP          *http.Client
+}
+
+func (f *BinanceFeed) Run(ctx context.Context, symbol string, out chan<- Update, report Reporter) error {
+	return failover{
+		exchange:      ExchangeBinance,
+		pollInterval:  f.PollInterval,
+		retryDelay:    f.RetryDelay,
+		maxRetryDelay: f.MaxRetryDelay,
+		stream:        f.stream,
+		fetch:         f.FetchTicker,
+	}.run(ctx, symbol, out, report)
+}
+
+// failover is the connection cycle every exchange feed shares: stream while
+// the stream works, and poll fetch between attempts to bring it back.
+type failover struct {
+	exchange      string
+	pollInterval  time.Duration
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	jitter        func(time.Duration) time.Duration
+	stream        func(ctx context.Context, symbol string, out chan<- Update, live func()) error
+	fetch         func(ctx context.Context, symbol string) (float64, *Stats, error)
+}
+
+func (f failover) run(ctx context.Context, symbol string, out chan<- Update, report Reporter) error {
+	b := backoff{min: f.retryDelay, max: f.maxRetryDelay, jitter: f.jitter}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			metrics.WSReconnects.WithLabelValues(f.exchange, symbol).Inc()
+		}
+		report(StateConnecting, nil)
+		err := f.stream(ctx, symbol, out, func() {
+			b.reset()
+			report(StateStreaming, nil)
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		wait := b.next()
+		report(StatePolling, err)
+		log.Warn().Err(err).Str("exchange", f.exchange).Str("symbol", symbol).Dur("retry_in", wait).Msg("price stream down, polling")
+
+		pctx, cancel := context.WithTimeout(ctx, wait)
+		_ = f.poll(pctx, symbol, out)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
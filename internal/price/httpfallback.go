@@ -8,29 +8,81 @@ import (
 	"time"
 )
 
-type httpTicker struct{ Price string `json:"price"` }
+type httpTicker struct {
+	Price string `json:"price"`
+}
+
+// FetchPrice returns the current ticker price for symbol from f.RESTURL.
+func (f *BinanceFeed) FetchPrice(ctx context.Context, symbol string) (float64, error) {
+	url := fmt.Sprintf("%s/api/v3/ticker/price?symbol=%s", f.RESTURL, symbol)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := f.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("binance ticker %s: %s", symbol, resp.Status)
+	}
+	var v httpTicker
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return 0, err
+	}
+	return parseFloat(v.Price)
+}
+
+// FetchTicker returns symbol's current price and 24h window from the 24hr
+// ticker at f.RESTURL.
+func (f *BinanceFeed) FetchTicker(ctx context.Context, symbol string) (float64, *Stats, error) {
+	url := fmt.Sprintf("%s/api/v3/ticker/24hr?symbol=%s", f.RESTURL, symbol)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := f.HTTP.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, fmt.Errorf("binance 24hr ticker %s: %s", symbol, resp.Status)
+	}
+	var v struct {
+		LastPrice          string `json:"lastPrice"`
+		HighPrice          string `json:"highPrice"`
+		LowPrice           string `json:"lowPrice"`
+		Volume             string `json:"volume"`
+		QuoteVolume        string `json:"quoteVolume"`
+		PriceChangePercent string `json:"priceChangePercent"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return 0, nil, err
+	}
+	p, err := parseFloat(v.LastPrice)
+	if err != nil {
+		return 0, nil, err
+	}
+	stats, _ := binanceTicker{
+		High: v.HighPrice, Low: v.LowPrice, Volume: v.Volume,
+		QuoteVolume: v.QuoteVolume, Change: v.PriceChangePercent,
+	}.stats()
+	return p, stats, nil
+}
 
-func pollHTTP(ctx context.Context, symbol string, out chan<- float64) error {
-	url := fmt.Sprintf("https://api.binance.com/api/v3/ticker/price?symbol=%s", symbol)
-	t := time.NewTicker(10 * time.Second)
+func (f failover) poll(ctx context.Context, symbol string, out chan<- Update) error {
+	t := time.NewTicker(f.pollInterval)
 	defer t.Stop()
 
 	for {
-		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil && resp.StatusCode == 200 {
-			var v httpTicker
-			if json.NewDecoder(resp.Body).Decode(&v) == nil {
-				if p, err := parseFloat(v.Price); err == nil {
-					select {
-					case out <- p:
-					case <-ctx.Done():
-						resp.Body.Close()
-						return ctx.Err()
-					}
-				}
+		if p, stats, err := f.fetch(ctx, symbol); err == nil {
+			select {
+			case out <- Update{Symbol: symbol, Price: p, Time: time.Now(), Transport: TransportHTTP, Stats: stats}:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
-			resp.Body.Close()
 		}
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,253 @@
+// Package pricetest provides an in-process fake of the Binance and Coinbase
+// ticker WebSocket and REST endpoints for exercising price feeds without
+// network access.
+package pricetest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"nhooyr.io/websocket"
+
+	"github.com/Secretstar513/crypto-alerts/internal/price"
+)
+
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	prices map[string]float64
+	stats  map[string]price.Stats
+	conns  map[string]map[*websocket.Conn]struct{}
+	// coinbase marks the conns speaking the Coinbase protocol.
+	coinbase map[*websocket.Conn]bool
+	rejectWS bool
+	failREST bool
+	wsDials  int
+	restHits int
+}
+
+// NewServer starts a fake exchange. Point price.BinanceFeed's or
+// price.CoinbaseFeed's WSURL at WSURL() and its RESTURL at s.URL; symbols are
+// always in Binance form.
+func NewServer() *Server {
+	s := &Server{
+		prices:   map[string]float64{},
+		stats:    map[string]price.Stats{},
+		conns:    map[string]map[*websocket.Conn]struct{}{},
+		coinbase: map[*websocket.Conn]bool{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// WSURL is the ws:// base URL of the fake stream endpoint.
+func (s *Server) WSURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// SetPrice sets symbol's REST price and pushes a ticker message to every
+// stream connected for it. Binance messages carry no 24h window.
+func (s *Server) SetPrice(symbol string, p float64) {
+	s.set(symbol, p, nil)
+}
+
+// SetTicker is SetPrice with a 24h window, sent in Binance messages and
+// REST responses.
+func (s *Server) SetTicker(symbol string, p float64, st price.Stats) {
+	s.set(symbol, p, &st)
+}
+
+func (s *Server) set(symbol string, p float64, st *price.Stats) {
+	s.mu.Lock()
+	s.prices[symbol] = p
+	delete(s.stats, symbol)
+	if st != nil {
+		s.stats[symbol] = *st
+	}
+	conns := make(map[*websocket.Conn]bool, len(s.conns[symbol]))
+	for c := range s.conns[symbol] {
+		conns[c] = s.coinbase[c]
+	}
+	s.mu.Unlock()
+
+	px := format(p)
+	ticker := map[string]any{"e": "24hrTicker", "s": symbol, "c": px}
+	if st != nil {
+		ticker["h"], ticker["l"] = format(st.High), format(st.Low)
+		ticker["v"], ticker["q"] = format(st.Volume), format(st.QuoteVolume)
+		ticker["P"] = format(st.ChangePercent)
+	}
+	msg, _ := json.Marshal(ticker)
+	cbMsg, _ := json.Marshal(map[string]any{"type": "ticker", "product_id": price.CoinbaseProduct(symbol), "price": px})
+	for c, cb := range conns {
+		if cb {
+			_ = c.Write(context.Background(), websocket.MessageText, cbMsg)
+		} else {
+			_ = c.Write(context.Background(), websocket.MessageText, msg)
+		}
+	}
+}
+
+// RejectStreams makes new WebSocket handshakes fail while reject is true.
+func (s *Server) RejectStreams(reject bool) {
+	s.mu.Lock()
+	s.rejectWS = reject
+	s.mu.Unlock()
+}
+
+// FailREST makes the REST ticker endpoint return 503 while fail is true.
+func (s *Server) FailREST(fail bool) {
+	s.mu.Lock()
+	s.failREST = fail
+	s.mu.Unlock()
+}
+
+// DropStreams closes every connected stream, as Binance does on its 24h
+// connection limit or during maintenance.
+func (s *Server) DropStreams() {
+	s.mu.Lock()
+	var conns []*websocket.Conn
+	for _, set := range s.conns {
+		for c := range set {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		_ = c.Close(websocket.StatusGoingAway, "maintenance")
+	}
+}
+
+// Streams reports how many streams are connected for symbol.
+func (s *Server) Streams(symbol string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns[symbol])
+}
+
+// Dials reports how many WebSocket handshakes were attempted.
+func (s *Server) Dials() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wsDials
+}
+
+// RESTHits reports how many REST ticker requests were served or failed.
+func (s *Server) RESTHits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restHits
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/ws/"):
+		// Paths look like /ws/<lowercase symbol>@ticker.
+		name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/ws/"), "@")
+		s.stream(w, r, strings.ToUpper(name), false)
+	case r.URL.Path == "/" && r.Header.Get("Upgrade") != "":
+		s.stream(w, r, "", true)
+	case r.URL.Path == "/api/v3/ticker/price", r.URL.Path == "/api/v3/ticker/24hr":
+		s.ticker(w, r, r.URL.Query().Get("symbol"), false)
+	case strings.HasPrefix(r.URL.Path, "/products/") && strings.HasSuffix(r.URL.Path, "/ticker"):
+		// Paths look like /products/BTC-USDT/ticker.
+		product := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/products/"), "/ticker")
+		s.ticker(w, r, strings.ReplaceAll(product, "-", ""), true)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// stream serves one ticker stream. Coinbase streams name their symbol in a
+// subscribe message rather than the path, so symbol is empty for them.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, symbol string, coinbase bool) {
+	s.mu.Lock()
+	s.wsDials++
+	reject := s.rejectWS
+	s.mu.Unlock()
+	if reject {
+		http.Error(w, "stream unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	if coinbase {
+		_, data, err := c.Read(r.Context())
+		if err != nil {
+			return
+		}
+		var sub struct {
+			ProductIDs []string `json:"product_ids"`
+		}
+		if json.Unmarshal(data, &sub) != nil || len(sub.ProductIDs) != 1 {
+			_ = c.Close(websocket.StatusPolicyViolation, "expected one product")
+			return
+		}
+		symbol = strings.ReplaceAll(sub.ProductIDs[0], "-", "")
+	}
+	s.mu.Lock()
+	if s.conns[symbol] == nil {
+		s.conns[symbol] = map[*websocket.Conn]struct{}{}
+	}
+	s.conns[symbol][c] = struct{}{}
+	s.coinbase[c] = coinbase
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns[symbol], c)
+		delete(s.coinbase, c)
+		s.mu.Unlock()
+	}()
+	// Clients never send after subscribing; reading just notices the close.
+	for {
+		if _, _, err := c.Read(r.Context()); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) ticker(w http.ResponseWriter, r *http.Request, symbol string, coinbase bool) {
+	s.mu.Lock()
+	s.restHits++
+	p, ok := s.prices[symbol]
+	st, hasStats := s.stats[symbol]
+	fail := s.failREST
+	s.mu.Unlock()
+
+	switch {
+	case fail:
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+	case !ok && coinbase:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]any{"message": "NotFound"})
+	case !ok:
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{"code": -1121, "msg": "Invalid symbol."})
+	case strings.HasSuffix(r.URL.Path, "/24hr"):
+		body := map[string]any{"symbol": symbol, "lastPrice": format(p)}
+		if hasStats {
+			body["highPrice"], body["lowPrice"] = format(st.High), format(st.Low)
+			body["volume"], body["quoteVolume"] = format(st.Volume), format(st.QuoteVolume)
+			body["priceChangePercent"] = format(st.ChangePercent)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"symbol": symbol, "price": format(p)})
+	}
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
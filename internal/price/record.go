@@ -0,0 +1,156 @@
+package price
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// record is one line of a recording file.
+type record struct {
+	Time   time.Time `json:"time"`
+	Symbol string    `json:"symbol"`
+	Price  float64   `json:"price"`
+	Stats  *Stats    `json:"stats,omitempty"`
+}
+
+// Recorder is a Feed that passes through the updates of another feed and
+// appends each one to a JSON-lines file readable by Replayer.
+type Recorder struct {
+	feed Feed
+	mu   sync.Mutex
+	w    *bufio.Writer
+	f    *os.File
+}
+
+// NewRecorder records feed to path, appending if the file exists.
+func NewRecorder(feed Feed, path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{feed: feed, w: bufio.NewWriter(f), f: f}, nil
+}
+
+func (r *Recorder) Run(ctx context.Context, symbol string, out chan<- Update, report Reporter) error {
+	in := make(chan Update, cap(out))
+	var err error
+	go func() {
+		err = r.feed.Run(ctx, symbol, in, report)
+		close(in)
+	}()
+
+	for upd := range in {
+		r.write(upd)
+		select {
+		case out <- upd:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (r *Recorder) write(upd Update) {
+	line, _ := json.Marshal(record{Time: upd.Time, Symbol: upd.Symbol, Price: upd.Price, Stats: upd.Stats})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(line)
+	r.w.WriteByte('\n')
+	// Flush per update so a crash loses at most the line being written.
+	r.w.Flush()
+}
+
+// Close flushes and closes the recording file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// Replayer is a Feed that plays back a recording made by Recorder. Gaps
+// between updates are divided by Speed; a Speed of 0 replays without waiting.
+// Run returns nil once the symbol's updates are exhausted.
+type Replayer struct {
+	Speed float64
+
+	start   time.Time
+	updates map[string][]Update
+	once    sync.Once
+	epoch   time.Time
+}
+
+// NewReplayer loads the recording at path.
+func NewReplayer(path string, speed float64) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecording(f, speed)
+}
+
+// ReadRecording loads a recording from r.
+func ReadRecording(r io.Reader, speed float64) (*Replayer, error) {
+	rp := &Replayer{Speed: speed, updates: map[string][]Update{}}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if rp.start.IsZero() || rec.Time.Before(rp.start) {
+			rp.start = rec.Time
+		}
+		rp.updates[rec.Symbol] = append(rp.updates[rec.Symbol], Update{
+			Symbol: rec.Symbol, Price: rec.Price, Time: rec.Time, Transport: TransportReplay, Stats: rec.Stats,
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, list := range rp.updates {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	}
+	return rp, nil
+}
+
+// Run replays symbol's updates with their recorded timestamps. All symbols
+// share one clock, started by the first Run call, so their relative order in
+// the recording is preserved.
+func (rp *Replayer) Run(ctx context.Context, symbol string, out chan<- Update, report Reporter) error {
+	rp.once.Do(func() { rp.epoch = time.Now() })
+	report(StateReplaying, nil)
+
+	for _, upd := range rp.updates[symbol] {
+		if rp.Speed > 0 {
+			at := rp.epoch.Add(time.Duration(float64(upd.Time.Sub(rp.start)) / rp.Speed))
+			if d := time.Until(at); d > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(d):
+				}
+			}
+		}
+		select {
+		case out <- upd:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package price
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sliceFeed sends its updates for the symbol asked for, then returns.
+type sliceFeed []Update
+
+func (f sliceFeed) Run(ctx context.Context, symbol string, out chan<- Update, report Reporter) error {
+	for _, upd := range f {
+		if upd.Symbol == symbol {
+			out <- upd
+		}
+	}
+	return nil
+}
+
+// recordTo runs feed through a Recorder on path for each symbol and returns
+// what the Recorder passed on.
+func recordTo(t *testing.T, path string, feed Feed, symbols ...string) []Update {
+	t.Helper()
+	r, err := NewRecorder(feed, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Update
+	for _, sym := range symbols {
+		out := make(chan Update, 10)
+		if err := r.Run(context.Background(), sym, out, func(State, error) {}); err != nil {
+			t.Fatal(err)
+		}
+		close(out)
+		for upd := range out {
+			got = append(got, upd)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.jsonl")
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	stats := &Stats{High: 102, Low: 95, Volume: 10, QuoteVolume: 1000, ChangePercent: 1.5}
+	first := sliceFeed{
+		{Symbol: "BTCUSDT", Price: 100, Time: start, Transport: TransportWS, Stats: stats},
+		{Symbol: "ETHUSDT", Price: 3000, Time: start.Add(time.Second), Transport: TransportHTTP},
+		{Symbol: "BTCUSDT", Price: 101, Time: start.Add(2 * time.Second), Transport: TransportWS},
+	}
+	second := sliceFeed{
+		{Symbol: "BTCUSDT", Price: 99, Time: start.Add(time.Minute), Transport: TransportWS},
+	}
+
+	if got := recordTo(t, path, first, "BTCUSDT", "ETHUSDT"); len(got) != len(first) {
+		t.Fatalf("recorder passed on %d updates, want %d", len(got), len(first))
+	}
+	// A second recording to the same file appends to it.
+	recordTo(t, path, second, "BTCUSDT")
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("recording has %d lines, want 4:\n%s", len(lines), raw)
+	}
+	if !strings.Contains(lines[0], `"stats":{`) || strings.Contains(lines[1], `"stats"`) {
+		t.Fatalf("stats written only when present, got:\n%s", raw)
+	}
+
+	rp, err := NewReplayer(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sym, want := range map[string][]Update{
+		"BTCUSDT": {first[0], first[2], second[0]},
+		"ETHUSDT": {first[1]},
+	} {
+		out := make(chan Update, 10)
+		var states []State
+		if err := rp.Run(context.Background(), sym, out, func(s State, _ error) { states = append(states, s) }); err != nil {
+			t.Fatal(err)
+		}
+		close(out)
+		var got []Update
+		for upd := range out {
+			got = append(got, upd)
+		}
+		for i := range want {
+			want[i].Transport = TransportReplay
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s replayed %+v, want %+v", sym, got, want)
+		}
+		if !reflect.DeepEqual(states, []State{StateReplaying}) {
+			t.Errorf("%s reported %v", sym, states)
+		}
+	}
+}
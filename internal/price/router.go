@@ -2,23 +2,50 @@ package price
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 )
 
 type Update struct {
-	Symbol string
-	Price  float64
+	Symbol    string
+	Price     float64
+	Time      time.Time
+	Transport string
+	// Stats is the rolling 24h window reported with the price, or nil when
+	// the source only reports prices.
+	Stats *Stats
 }
 
+// Stats summarises a symbol's trading over the last 24 hours. Volume is in
+// the base asset (BTC for BTCUSDT), QuoteVolume in the quote asset (USDT).
+type Stats struct {
+	High          float64 `json:"high"`
+	Low           float64 `json:"low"`
+	Volume        float64 `json:"volume"`
+	QuoteVolume   float64 `json:"quoteVolume"`
+	ChangePercent float64 `json:"changePercent"`
+}
+
+// Transports reported in Update.Transport.
+const (
+	TransportWS     = "ws"
+	TransportHTTP   = "http"
+	TransportReplay = "replay"
+)
+
 type Subscriber chan Update
 
 type Router struct {
 	mu       sync.Mutex
+	exchange string
+	feed     Feed
 	streams  map[string]*symbolStream
 }
 
-func NewRouter() *Router {
-	return &Router{streams: map[string]*symbolStream{}}
+// NewRouter fans out updates from exchange's feed to per-symbol subscribers.
+func NewRouter(exchange string, feed Feed) *Router {
+	return &Router{exchange: exchange, feed: feed, streams: map[string]*symbolStream{}}
 }
 
 func (r *Router) Subscribe(ctx context.Context, symbol string) Subscriber {
@@ -26,12 +53,16 @@ func (r *Router) Subscribe(ctx context.Context, symbol string) Subscriber {
 	defer r.mu.Unlock()
 	s, ok := r.streams[symbol]
 	if !ok {
-		s = newSymbolStream(symbol)
+		s = newSymbolStream(r.exchange, symbol, r.feed)
 		r.streams[symbol] = s
-		go s.run(ctx)
 	}
 	ch := make(Subscriber, 16)
 	s.add(ch)
+	// Start after adding the first subscriber so a fast feed, such as a
+	// replay, can't emit before anyone is listening.
+	if !ok {
+		go s.run(ctx)
+	}
 	return ch
 }
 
@@ -42,3 +73,15 @@ func (r *Router) StopAll() {
 		s.stop()
 	}
 }
+
+// Status returns the state of every symbol stream, sorted by symbol.
+func (r *Router) Status() []StreamStatus {
+	r.mu.Lock()
+	out := make([]StreamStatus, 0, len(r.streams))
+	for _, s := range r.streams {
+		out = append(out, s.snapshot())
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
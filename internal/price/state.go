@@ -0,0 +1,63 @@
+package price
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// State is where a symbol's feed is in its failover cycle:
+// CONNECTING → STREAMING (WebSocket) → POLLING (REST, degraded) → CONNECTING …
+type State string
+
+const (
+	StateConnecting State = "CONNECTING"
+	StateStreaming  State = "STREAMING"
+	StatePolling    State = "POLLING"
+	StateReplaying  State = "REPLAYING"
+	StateStopped    State = "STOPPED"
+)
+
+// Reporter is called by a feed whenever its state changes; err is the reason
+// for leaving the previous state, if any.
+type Reporter func(s State, err error)
+
+// StreamStatus is a snapshot of one symbol's stream. LastUpdate is zero until
+// the first price arrives.
+type StreamStatus struct {
+	Exchange   string
+	Symbol     string
+	State      State
+	Since      time.Time
+	LastError  string
+	Started    time.Time
+	LastUpdate time.Time
+	LastPrice  float64
+	Transport  string
+}
+
+// backoff yields exponentially growing delays between min and max with equal
+// jitter: each delay is half the step plus a random share of the other half,
+// so streams that failed together don't all retry together.
+type backoff struct {
+	min, max time.Duration
+	step     time.Duration
+	// jitter returns a random duration in [0, n); rand.N when nil.
+	jitter func(n time.Duration) time.Duration
+}
+
+func (b *backoff) next() time.Duration {
+	if b.step == 0 {
+		b.step = b.min
+	}
+	d := b.step
+	if b.step < b.max {
+		b.step = min(2*b.step, b.max)
+	}
+	half := d / 2
+	if b.jitter == nil {
+		return half + rand.N(d-half+1)
+	}
+	return half + b.jitter(d-half+1)
+}
+
+func (b *backoff) reset() { b.step = 0 }
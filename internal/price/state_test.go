@@ -0,0 +1,89 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func noJitter(time.Duration) time.Duration     { return 0 }
+func fullJitter(n time.Duration) time.Duration { return n - 1 }
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		jitter func(time.Duration) time.Duration
+		want   []time.Duration
+	}{
+		// Half of each step, doubling up to the cap.
+		{"least jitter", noJitter, []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 2500 * time.Millisecond, 2500 * time.Millisecond}},
+		// The whole step, never beyond the cap.
+		{"most jitter", fullJitter, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}},
+	} {
+		b := backoff{min: time.Second, max: 5 * time.Second, jitter: tc.jitter}
+		for i, want := range tc.want {
+			if got := b.next(); got != want {
+				t.Errorf("%s: delay %d = %s, want %s", tc.name, i, got, want)
+			}
+		}
+		b.reset()
+		if got := b.next(); got != tc.want[0] {
+			t.Errorf("%s: after reset = %s, want %s", tc.name, got, tc.want[0])
+		}
+	}
+
+	// The default source stays within half a step and the step.
+	b := backoff{min: time.Second, max: 5 * time.Second}
+	for _, step := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := b.next(); got < step/2 || got > step {
+			t.Errorf("delay %s outside [%s, %s]", got, step/2, step)
+		}
+	}
+}
+
+func TestFailoverBackoffResetsAfterStreaming(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const unit = 40 * time.Millisecond
+	var attempts int
+	var waits []time.Duration
+	f := failover{
+		exchange:      "test",
+		pollInterval:  time.Hour,
+		retryDelay:    unit,
+		maxRetryDelay: 4 * unit,
+		jitter:        fullJitter,
+		stream: func(ctx context.Context, symbol string, out chan<- Update, live func()) error {
+			attempts++
+			switch attempts {
+			case 5:
+				live()
+			case 7:
+				cancel()
+			}
+			return errors.New("stream down")
+		},
+		// The poll between attempts lasts as long as the backoff delay.
+		fetch: func(ctx context.Context, symbol string) (float64, *Stats, error) {
+			deadline, _ := ctx.Deadline()
+			waits = append(waits, time.Until(deadline))
+			return 0, nil, errors.New("no price")
+		},
+	}
+	if err := f.run(ctx, "BTCUSDT", nil, func(State, error) {}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("run = %v", err)
+	}
+
+	// Attempt 5 streamed before failing, so the delay starts over.
+	want := []time.Duration{unit, 2 * unit, 4 * unit, 4 * unit, unit, 2 * unit}
+	if len(waits) != len(want) {
+		t.Fatalf("polled %d times, want %d: %v", len(waits), len(want), waits)
+	}
+	for i, w := range want {
+		if waits[i] > w || waits[i] < w*3/4 {
+			t.Errorf("wait %d = %s, want about %s", i, waits[i], w)
+		}
+	}
+}
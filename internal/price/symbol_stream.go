@@ -2,24 +2,53 @@ package price
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Secretstar513/crypto-alerts/internal/metrics"
 )
 
 type symbolStream struct {
-	symbol string
-	subs   map[Subscriber]struct{}
-	mu     sync.Mutex
-	cancel context.CancelFunc
+	exchange string
+	symbol   string
+	feed     Feed
+	subs     map[Subscriber]struct{}
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	status   StreamStatus
 }
 
-func newSymbolStream(symbol string) *symbolStream {
+func newSymbolStream(exchange, symbol string, feed Feed) *symbolStream {
 	return &symbolStream{
-		symbol: symbol,
-		subs:   map[Subscriber]struct{}{},
+		exchange: exchange,
+		symbol:   symbol,
+		feed:     feed,
+		subs:     map[Subscriber]struct{}{},
+		status:   StreamStatus{Exchange: exchange, Symbol: symbol, State: StateConnecting, Since: time.Now(), Started: time.Now()},
 	}
 }
 
+func (s *symbolStream) report(st State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	if st != s.status.State {
+		s.status.State = st
+		s.status.Since = time.Now()
+	}
+}
+
+func (s *symbolStream) snapshot() StreamStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
 func (s *symbolStream) add(sub Subscriber) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -36,30 +65,36 @@ func (s *symbolStream) run(parent context.Context) {
 	ctx, cancel := context.WithCancel(parent)
 	s.cancel = cancel
 
-	out := make(chan float64, 8)
+	out := make(chan Update, 8)
 
 	go func() {
-		for {
-			if err := streamBinance(ctx, s.symbol, out); err != nil {
-				_ = pollHTTP(ctx, s.symbol, out)
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.After(30 * time.Second):
-				}
-			}
+		err := s.feed.Run(ctx, s.symbol, out, s.report)
+		if errors.Is(err, context.Canceled) {
+			err = nil
 		}
+		if err != nil {
+			log.Error().Err(err).Str("exchange", s.exchange).Str("symbol", s.symbol).Msg("price feed stopped")
+		}
+		s.report(StateStopped, err)
 	}()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case p := <-out:
+		case upd := <-out:
+			metrics.PriceUpdates.WithLabelValues(s.exchange, s.symbol, upd.Transport).Inc()
+			now := time.Now()
+			metrics.LastUpdate.WithLabelValues(s.exchange, s.symbol).Set(float64(now.UnixNano()) / 1e9)
 			s.mu.Lock()
+			s.status.LastUpdate = now
+			s.status.LastPrice = upd.Price
+			s.status.Transport = upd.Transport
 			for ch := range s.subs {
-				select { case ch <- Update{Symbol: s.symbol, Price: p}:
+				select {
+				case ch <- upd:
 				default:
+					metrics.DroppedUpdates.WithLabelValues(s.exchange, s.symbol).Inc()
 				}
 			}
 			s.mu.Unlock()
@@ -15,3 +15,17 @@ func Crosses(prev, current float64, a *domain.Alert) bool {
 		return false
 	}
 }
+
+// CrossesLine is Crosses against a moving line: it reports whether a value
+// going from prev to current crossed a line going from prevLine to curLine,
+// upward or downward as dir says.
+func CrossesLine(prev, current, prevLine, curLine float64, dir domain.Direction) bool {
+	switch dir {
+	case domain.DirectionUp:
+		return prev < prevLine && current >= curLine
+	case domain.DirectionDown:
+		return prev > prevLine && current <= curLine
+	default:
+		return false
+	}
+}
@@ -0,0 +1,528 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed, type-checked condition over the prices of one or more
+// symbols, such as
+//
+//	BTCUSDT > 70000 AND ETHUSDT > 4000
+//	SOLUSDT crosses up 200 while BTCUSDT above 65000
+//
+// Comparisons are >, >=, <, <= (or above/below); "X crosses up|down Y" holds
+// on the update where X crosses Y the same way Crosses does for a single
+// alert. Conditions combine with AND (or WHILE), OR, NOT and parentheses;
+// NOT can't apply to a crosses, which would never fire. Keywords are
+// case-insensitive; symbols are uppercase and may start with digits.
+type Expr struct {
+	src     string
+	root    node
+	symbols []string
+}
+
+// Parse parses and type-checks src.
+func Parse(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	if err := check(root, true); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	walk(root, func(n node) {
+		if s, ok := n.(symbolRef); ok {
+			seen[s.name] = true
+		}
+	})
+	e := &Expr{src: strings.TrimSpace(src), root: root}
+	for s := range seen {
+		e.symbols = append(e.symbols, s)
+	}
+	sort.Strings(e.symbols)
+	return e, nil
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Symbols returns the symbols e references, sorted.
+func (e *Expr) Symbols() []string { return e.symbols }
+
+// References reports whether e depends on the price of symbol.
+func (e *Expr) References(symbol string) bool {
+	i := sort.SearchStrings(e.symbols, symbol)
+	return i < len(e.symbols) && e.symbols[i] == symbol
+}
+
+// Eval reports whether e holds at cur, with prev the prices before the latest
+// update for "crosses". Conditions on a symbol without a price are false.
+func (e *Expr) Eval(prev, cur map[string]float64) bool {
+	return cond(e.root, prev, cur)
+}
+
+// Fires reports whether e became true with the update from prev to cur: it
+// holds now but didn't before. Like a single crossing alert, a condition that
+// stays true fires once rather than on every update.
+func (e *Expr) Fires(prev, cur map[string]float64) bool {
+	return e.Eval(prev, cur) && !e.Eval(prev, prev)
+}
+
+// AST
+
+type node interface{ pos() int }
+
+type (
+	number struct {
+		at int
+		v  float64
+	}
+	symbolRef struct {
+		at   int
+		name string
+	}
+	notNode struct {
+		at int
+		x  node
+	}
+	logic struct {
+		at   int
+		and  bool
+		l, r node
+	}
+	compare struct {
+		at   int
+		op   string // >, >=, <, <=
+		l, r node
+	}
+	crosses struct {
+		at   int
+		up   bool
+		l, r node
+	}
+)
+
+func (n number) pos() int    { return n.at }
+func (n symbolRef) pos() int { return n.at }
+func (n notNode) pos() int   { return n.at }
+func (n logic) pos() int     { return n.at }
+func (n compare) pos() int   { return n.at }
+func (n crosses) pos() int   { return n.at }
+
+func walk(n node, f func(node)) {
+	f(n)
+	switch n := n.(type) {
+	case notNode:
+		walk(n.x, f)
+	case logic:
+		walk(n.l, f)
+		walk(n.r, f)
+	case compare:
+		walk(n.l, f)
+		walk(n.r, f)
+	case crosses:
+		walk(n.l, f)
+		walk(n.r, f)
+	}
+}
+
+// Type checking: conditions and prices may only appear where each is
+// expected, and every comparison must involve at least one symbol.
+
+func check(n node, wantCond bool) error {
+	isCond := false
+	switch n := n.(type) {
+	case notNode:
+		isCond = true
+		if err := check(n.x, true); err != nil {
+			return err
+		}
+		var negated *crosses
+		walk(n.x, func(x node) {
+			if c, ok := x.(crosses); ok && negated == nil {
+				negated = &c
+			}
+		})
+		if negated != nil {
+			return exprErrorf(negated.at, "crosses can't be negated: it only holds on the update where the cross happens, so NOT of it would never fire")
+		}
+	case logic:
+		isCond = true
+		if err := check(n.l, true); err != nil {
+			return err
+		}
+		if err := check(n.r, true); err != nil {
+			return err
+		}
+	case compare:
+		isCond = true
+		if err := checkOperands(n.at, n.l, n.r); err != nil {
+			return err
+		}
+	case crosses:
+		isCond = true
+		if err := checkOperands(n.at, n.l, n.r); err != nil {
+			return err
+		}
+	}
+	switch {
+	case wantCond && !isCond:
+		return exprErrorf(n.pos(), "%s is a price, not a condition; compare it, e.g. %s > 100", describe(n), describe(n))
+	case !wantCond && isCond:
+		return exprErrorf(n.pos(), "expected a symbol or number, got a condition")
+	}
+	return nil
+}
+
+func checkOperands(at int, l, r node) error {
+	if err := check(l, false); err != nil {
+		return err
+	}
+	if err := check(r, false); err != nil {
+		return err
+	}
+	_, ls := l.(symbolRef)
+	_, rs := r.(symbolRef)
+	if !ls && !rs {
+		return exprErrorf(at, "comparison of two numbers is constant")
+	}
+	return nil
+}
+
+func describe(n node) string {
+	switch n := n.(type) {
+	case symbolRef:
+		return n.name
+	case number:
+		return strconv.FormatFloat(n.v, 'f', -1, 64)
+	}
+	return "expression"
+}
+
+// Evaluation
+
+func cond(n node, prev, cur map[string]float64) bool {
+	switch n := n.(type) {
+	case notNode:
+		return !cond(n.x, prev, cur)
+	case logic:
+		if n.and {
+			return cond(n.l, prev, cur) && cond(n.r, prev, cur)
+		}
+		return cond(n.l, prev, cur) || cond(n.r, prev, cur)
+	case compare:
+		l, lok := value(n.l, cur)
+		r, rok := value(n.r, cur)
+		if !lok || !rok {
+			return false
+		}
+		switch n.op {
+		case ">":
+			return l > r
+		case ">=":
+			return l >= r
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		}
+	case crosses:
+		lp, ok1 := value(n.l, prev)
+		rp, ok2 := value(n.r, prev)
+		lc, ok3 := value(n.l, cur)
+		rc, ok4 := value(n.r, cur)
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return false
+		}
+		if n.up {
+			return lp < rp && lc >= rc
+		}
+		return lp > rp && lc <= rc
+	}
+	return false
+}
+
+// value returns the price a number or symbol stands for; a symbol without a
+// price yet has none.
+func value(n node, prices map[string]float64) (float64, bool) {
+	switch n := n.(type) {
+	case number:
+		return n.v, true
+	case symbolRef:
+		p := prices[n.name]
+		return p, p != 0
+	}
+	return 0, false
+}
+
+// Parsing
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokKind
+	text string
+	at   int // byte offset in the source
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// keyword reports whether t is the (case-insensitive) keyword kw.
+func (t token) keyword(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+var keywords = []string{"and", "while", "or", "not", "crosses", "up", "down", "above", "below"}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *parser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			p.toks = append(p.toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			p.toks = append(p.toks, token{tokRParen, ")", i})
+			i++
+		case strings.ContainsRune("<>!&|", c):
+			j := i + 1
+			if j < len(s) && (s[j] == '=' || (c == '&' && s[j] == '&') || (c == '|' && s[j] == '|')) {
+				j++
+			}
+			op := s[i:j]
+			if op == "&" || op == "|" || op == "!=" {
+				return exprErrorf(i, "unknown operator %q", op)
+			}
+			p.toks = append(p.toks, token{tokOp, op, i})
+			i = j
+		case c >= '0' && c <= '9' && startsIdent(s[i:]):
+			// A symbol may start with digits, e.g. 1INCHUSDT.
+			j := identEnd(s, i)
+			p.toks = append(p.toks, token{tokIdent, s[i:j], i})
+			i = j
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			if _, err := strconv.ParseFloat(s[i:j], 64); err != nil {
+				return exprErrorf(i, "bad number %q", s[i:j])
+			}
+			p.toks = append(p.toks, token{tokNumber, s[i:j], i})
+			i = j
+		case c < unicode.MaxASCII && (unicode.IsLetter(c) || c == '_'):
+			j := identEnd(s, i)
+			p.toks = append(p.toks, token{tokIdent, s[i:j], i})
+			i = j
+		default:
+			return exprErrorf(i, "unexpected character %q", c)
+		}
+	}
+	p.toks = append(p.toks, token{kind: tokEOF, at: len(s)})
+	return nil
+}
+
+func isIdentByte(c byte) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || c == '_')
+}
+
+// identEnd returns the end of the identifier starting at s[i].
+func identEnd(s string, i int) int {
+	for i < len(s) && isIdentByte(s[i]) {
+		i++
+	}
+	return i
+}
+
+// startsIdent reports whether s, which starts with a digit, is an identifier:
+// its leading digits continue with a letter or underscore.
+func startsIdent(s string) bool {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i < len(s) && s[i] != '.' && isIdentByte(s[i])
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return exprErrorf(t.at, format, args...)
+}
+
+// or := and { ("OR" | "||") and }
+func (p *parser) or() (node, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.keyword("or") || t.text == "||"; t = p.peek() {
+		p.next()
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = logic{at: t.at, l: l, r: r}
+	}
+	return l, nil
+}
+
+// and := not { ("AND" | "WHILE" | "&&") not }
+func (p *parser) and() (node, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.keyword("and") || t.keyword("while") || t.text == "&&"; t = p.peek() {
+		p.next()
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = logic{at: t.at, and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+// not := ("NOT" | "!") not | comparison
+func (p *parser) not() (node, error) {
+	if t := p.peek(); t.keyword("not") || t.text == "!" {
+		p.next()
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{at: t.at, x: x}, nil
+	}
+	return p.comparison()
+}
+
+// comparison := primary [ op primary | "CROSSES" ("UP" | "DOWN") primary ]
+func (p *parser) comparison() (node, error) {
+	l, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && strings.ContainsAny(t.text[:1], "<>"):
+		p.next()
+		r, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return compare{at: t.at, op: t.text, l: l, r: r}, nil
+	case t.keyword("above"), t.keyword("below"):
+		p.next()
+		r, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if t.keyword("below") {
+			op = "<"
+		}
+		return compare{at: t.at, op: op, l: l, r: r}, nil
+	case t.keyword("crosses"):
+		p.next()
+		dir := p.next()
+		up := dir.keyword("up") || dir.keyword("above")
+		if !up && !dir.keyword("down") && !dir.keyword("below") {
+			return nil, p.errorf(dir, "expected up or down after crosses, got %s", dir)
+		}
+		r, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return crosses{at: t.at, up: up, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+// primary := NUMBER | SYMBOL | "(" or ")"
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, _ := strconv.ParseFloat(t.text, 64)
+		return number{at: t.at, v: v}, nil
+	case tokIdent:
+		for _, kw := range keywords {
+			if t.keyword(kw) {
+				return nil, p.errorf(t, "expected a symbol, number or (, got %s", t)
+			}
+		}
+		if strings.ToUpper(t.text) != t.text {
+			return nil, p.errorf(t, "symbol %s must be uppercase, e.g. %s", t, strings.ToUpper(t.text))
+		}
+		return symbolRef{at: t.at, name: t.text}, nil
+	case tokLParen:
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, p.errorf(c, "expected ), got %s", c)
+		}
+		return x, nil
+	}
+	return nil, p.errorf(t, "expected a symbol, number or (, got %s", t)
+}
+
+// ExprError reports where in the source an expression failed to parse or
+// type-check.
+type ExprError struct {
+	Pos int // byte offset
+	Msg string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("condition: %s (at column %d)", e.Msg, e.Pos+1)
+}
+
+func exprErrorf(pos int, format string, args ...any) error {
+	return &ExprError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,155 @@
+package rules
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePrecedence(t *testing.T) {
+	// A is 2, B is 1 and C is 3 throughout, so each case is true only when
+	// the operators group the way the grammar says.
+	prices := map[string]float64{"A": 2, "B": 1, "C": 3}
+	for _, tc := range []struct {
+		src  string
+		want bool
+	}{
+		{"A > 1 OR B > 1 AND C > 5", true},    // A > 1 OR (B > 1 AND C > 5)
+		{"(A > 1 OR B > 1) AND C > 5", false}, // parentheses win
+		{"NOT A > 5 AND B < 2", true},         // (NOT A > 5) AND B < 2
+		{"NOT (A > 5 OR B < 2)", false},
+		{"! A > 1 || C >= 3", true},
+		{"A > 1 && B > 1 || C <= 3", true},
+		{"A above 1 while B below 2", true},
+		{"A > 1 or B > 1 And C > 5", true},
+		{"A >= 2 AND A <= 2 AND NOT NOT A < 3", true},
+		{"1 < A AND 4 > C", true},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.src, err)
+			continue
+		}
+		if got := e.Eval(prices, prices); got != tc.want {
+			t.Errorf("Eval(%q) = %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestParseSymbols(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want []string
+	}{
+		{"BTCUSDT > 70000 AND ETHUSDT > 4000 OR BTCUSDT < 1", []string{"BTCUSDT", "ETHUSDT"}},
+		{"1INCHUSDT > 0.5", []string{"1INCHUSDT"}},
+		{"1000SATSUSDT crosses up 0.0003 and 1INCHUSDT>.4", []string{"1000SATSUSDT", "1INCHUSDT"}},
+		{"SOL_USDT > 2", []string{"SOL_USDT"}},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(e.Symbols(), tc.want) {
+			t.Errorf("Parse(%q).Symbols() = %v, want %v", tc.src, e.Symbols(), tc.want)
+		}
+		for _, s := range tc.want {
+			if !e.References(s) {
+				t.Errorf("Parse(%q).References(%s) = false", tc.src, s)
+			}
+		}
+		if e.References("XRPUSDT") {
+			t.Errorf("Parse(%q).References(XRPUSDT) = true", tc.src)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		pos  int
+		want string
+	}{
+		{"BTCUSDT AND ETHUSDT", 0, "BTCUSDT is a price, not a condition"},
+		{"BTCUSDT > 1 AND 5", 16, "5 is a price, not a condition"},
+		{"70000 > 60000", 6, "comparison of two numbers is constant"},
+		{"(BTCUSDT > 1) > 2", 9, "expected a symbol or number, got a condition"},
+		{"BTCUSDT > (ETHUSDT < 2)", 19, "expected a symbol or number, got a condition"},
+		{"btcusdt > 1", 0, "must be uppercase, e.g. BTCUSDT"},
+		{"BTCUSDT crosses 5", 16, "expected up or down after crosses"},
+		{"BTCUSDT > 1 AND", 15, "expected a symbol, number or (, got end of expression"},
+		{"BTCUSDT > AND", 10, `expected a symbol, number or (, got "AND"`},
+		{"(BTCUSDT > 1", 12, "expected ), got end of expression"},
+		{"BTCUSDT > 1 ETHUSDT", 12, `unexpected "ETHUSDT"`},
+		{"BTCUSDT != 1", 8, `unknown operator "!="`},
+		{"BTCUSDT > 1 & ETHUSDT > 1", 12, `unknown operator "&"`},
+		{"BTCUSDT > 1.2.3", 10, `bad number "1.2.3"`},
+		{"BTCUSDT > $5", 10, "unexpected character"},
+		{"NOT BTCUSDT crosses up 5", 12, "crosses can't be negated"},
+		{"!(ETHUSDT > 1 AND BTCUSDT crosses down ETHUSDT)", 26, "crosses can't be negated"},
+	} {
+		_, err := Parse(tc.src)
+		var ee *ExprError
+		if !errors.As(err, &ee) {
+			t.Errorf("Parse(%q) = %v, want an ExprError", tc.src, err)
+			continue
+		}
+		if ee.Pos != tc.pos || !strings.Contains(ee.Msg, tc.want) {
+			t.Errorf("Parse(%q) = %q at %d, want %q at %d", tc.src, ee.Msg, ee.Pos, tc.want, tc.pos)
+		}
+	}
+}
+
+func TestCrossesAndFires(t *testing.T) {
+	for _, tc := range []struct {
+		src        string
+		prev, cur  map[string]float64
+		eval, fire bool
+	}{
+		// crosses holds only on the update that crosses, like Crosses.
+		{"A crosses up 10", map[string]float64{"A": 9}, map[string]float64{"A": 10}, true, true},
+		{"A crosses up 10", map[string]float64{"A": 10}, map[string]float64{"A": 11}, false, false},
+		{"A crosses up 10", map[string]float64{"A": 11}, map[string]float64{"A": 9}, false, false},
+		{"A crosses above 10", map[string]float64{"A": 9}, map[string]float64{"A": 12}, true, true},
+		{"A crosses down 10", map[string]float64{"A": 11}, map[string]float64{"A": 10}, true, true},
+		{"A crosses below 10", map[string]float64{"A": 9}, map[string]float64{"A": 8}, false, false},
+		// A symbol crossing another: B is unchanged, A passes it.
+		{"A crosses up B", map[string]float64{"A": 4, "B": 5}, map[string]float64{"A": 6, "B": 5}, true, true},
+		// No previous price: nothing has crossed yet.
+		{"A crosses up 10", map[string]float64{}, map[string]float64{"A": 11}, false, false},
+		// A comparison fires when it becomes true, not while it stays true.
+		{"A > 10", map[string]float64{"A": 9}, map[string]float64{"A": 11}, true, true},
+		{"A > 10", map[string]float64{"A": 11}, map[string]float64{"A": 12}, true, false},
+		{"A > 10 AND B < 5", map[string]float64{"A": 11, "B": 6}, map[string]float64{"A": 11, "B": 4}, true, true},
+		// A symbol without a price makes its comparisons false.
+		{"A > 10 OR B > 0", map[string]float64{"A": 9}, map[string]float64{"A": 9}, false, false},
+		{"NOT B > 0", map[string]float64{}, map[string]float64{}, true, false},
+		// crosses combined with a level fires with the crossing update.
+		{"A crosses up 10 while B above 5", map[string]float64{"A": 9, "B": 6}, map[string]float64{"A": 10, "B": 6}, true, true},
+		{"A crosses up 10 while B above 5", map[string]float64{"A": 9, "B": 4}, map[string]float64{"A": 10, "B": 4}, false, false},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.src, err)
+			continue
+		}
+		if got := e.Eval(tc.prev, tc.cur); got != tc.eval {
+			t.Errorf("%q: Eval(%v, %v) = %v, want %v", tc.src, tc.prev, tc.cur, got, tc.eval)
+		}
+		if got := e.Fires(tc.prev, tc.cur); got != tc.fire {
+			t.Errorf("%q: Fires(%v, %v) = %v, want %v", tc.src, tc.prev, tc.cur, got, tc.fire)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	e, err := Parse("  BTCUSDT > 1  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.String() != "BTCUSDT > 1" {
+		t.Fatalf("String() = %q", e.String())
+	}
+}
@@ -0,0 +1,296 @@
+// Package secrets encrypts small values at rest with envelope encryption:
+// every value is sealed with its own random data key, and the data key is
+// sealed with a master key. Rotating the master key only re-seals the data
+// keys, never the values themselves.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefix marks sealed values; anything without it is plaintext from before
+// encryption was turned on.
+const prefix = "enc:v1:"
+
+// KeySize is the length of master and data keys (AES-256).
+const KeySize = 32
+
+var (
+	// ErrNoKey is returned when a sealed value is opened without a keyring.
+	ErrNoKey = errors.New("secrets: value is encrypted but no master key is configured")
+	// ErrUnknownKey is returned when a value was sealed under a master key
+	// the keyring doesn't hold.
+	ErrUnknownKey = errors.New("secrets: value was sealed with an unknown master key")
+)
+
+// Keyring holds the current master key, used for sealing, and any previous
+// keys still needed to open values sealed before a rotation.
+type Keyring struct {
+	current *masterKey
+	keys    map[string]*masterKey
+}
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewKeyring builds a keyring that seals with current and opens values
+// sealed with current or any of previous.
+func NewKeyring(current []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: map[string]*masterKey{}}
+	for i, raw := range append([][]byte{current}, previous...) {
+		mk, err := newMasterKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			k.current = mk
+		}
+		if _, ok := k.keys[mk.id]; !ok {
+			k.keys[mk.id] = mk
+		}
+	}
+	return k, nil
+}
+
+// LoadKeyring builds a keyring from base64 keys. The current key comes from
+// key or, if that is empty, the first line of file; later lines of file are
+// previous keys, as is every entry of previous. It returns nil and no error
+// when no key is configured at all.
+func LoadKeyring(key, file string, previous []string) (*Keyring, error) {
+	if key != "" && file != "" {
+		return nil, errors.New("secrets: set either a key or a key file, not both")
+	}
+	encoded := previous
+	if key != "" {
+		encoded = append([]string{key}, previous...)
+	}
+	if file != "" {
+		lines, err := readKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(lines, previous...)
+	}
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	if key == "" && file == "" {
+		return nil, errors.New("secrets: previous keys are set without a current key")
+	}
+	raw := make([][]byte, len(encoded))
+	for i, s := range encoded {
+		b, err := ParseKey(s)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = b
+	}
+	return NewKeyring(raw[0], raw[1:]...)
+}
+
+// readKeyFile returns the non-blank lines of path that aren't # comments.
+func readKeyFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("secrets: %s holds no key", path)
+	}
+	return lines, nil
+}
+
+// ParseKey decodes a base64 master key, as printed by GenerateKey or
+// `openssl rand -base64 32`.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		b, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+	if err != nil {
+		return nil, errors.New("secrets: master key is not valid base64")
+	}
+	if len(b) != KeySize {
+		return nil, fmt.Errorf("secrets: master key is %d bytes, want %d", len(b), KeySize)
+	}
+	return b, nil
+}
+
+// GenerateKey returns a new random master key, base64 encoded.
+func GenerateKey() (string, error) {
+	b, err := randomBytes(KeySize)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func newMasterKey(raw []byte) (*masterKey, error) {
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets: key is %d bytes, want %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsSealed reports whether s is a sealed value rather than plaintext.
+func IsSealed(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Seal encrypts plaintext under a fresh data key and seals the data key with
+// the current master key.
+func (k *Keyring) Seal(plaintext []byte) (string, error) {
+	dek, err := randomBytes(KeySize)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	body, err := seal(aead, plaintext, nil)
+	if err != nil {
+		return "", err
+	}
+	return k.current.wrap(dek, body)
+}
+
+// Open decrypts a value produced by Seal. It is safe to call on a nil
+// Keyring, which fails with ErrNoKey.
+func (k *Keyring) Open(s string) ([]byte, error) {
+	mk, wrapped, body, err := k.parse(s)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := open(mk.aead, wrapped, []byte(mk.id))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: data key: %w", err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(aead, body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Stale reports whether s is sealed under a master key other than the
+// current one and so should be passed through Rewrap.
+func (k *Keyring) Stale(s string) bool {
+	id, _, _ := strings.Cut(strings.TrimPrefix(s, prefix), ":")
+	return IsSealed(s) && id != k.current.id
+}
+
+// Rewrap re-seals the data key of s under the current master key, leaving
+// the encrypted value itself untouched.
+func (k *Keyring) Rewrap(s string) (string, error) {
+	mk, wrapped, body, err := k.parse(s)
+	if err != nil {
+		return "", err
+	}
+	dek, err := open(mk.aead, wrapped, []byte(mk.id))
+	if err != nil {
+		return "", fmt.Errorf("secrets: data key: %w", err)
+	}
+	return k.current.wrap(dek, body)
+}
+
+// parse splits a sealed value, enc:v1:<key id>:<sealed data key>:<sealed
+// value>, and finds the master key it names.
+func (k *Keyring) parse(s string) (mk *masterKey, wrapped, body []byte, err error) {
+	if !IsSealed(s) {
+		return nil, nil, nil, errors.New("secrets: value is not sealed")
+	}
+	if k == nil {
+		return nil, nil, nil, ErrNoKey
+	}
+	parts := strings.Split(strings.TrimPrefix(s, prefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, nil, errors.New("secrets: malformed sealed value")
+	}
+	mk, ok := k.keys[parts[0]]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w %s", ErrUnknownKey, parts[0])
+	}
+	if wrapped, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, nil, nil, errors.New("secrets: malformed sealed value")
+	}
+	if body, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, nil, nil, errors.New("secrets: malformed sealed value")
+	}
+	return mk, wrapped, body, nil
+}
+
+// wrap seals dek under mk, binding it to the key id, and formats the result
+// together with the already sealed body.
+func (mk *masterKey) wrap(dek, body []byte) (string, error) {
+	wrapped, err := seal(mk.aead, dek, []byte(mk.id))
+	if err != nil {
+		return "", err
+	}
+	return prefix + mk.id + ":" + base64.RawURLEncoding.EncodeToString(wrapped) + ":" + base64.RawURLEncoding.EncodeToString(body), nil
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended to the
+// result.
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], ad)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("secrets: random: %w", err)
+	}
+	return b, nil
+}
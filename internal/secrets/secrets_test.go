@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func keyring(t *testing.T, current string, previous ...string) *Keyring {
+	t.Helper()
+	k, err := LoadKeyring(current, "", previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := keyring(t, newKey(t))
+	for _, plain := range []string{`{"botToken":"123:SECRET"}`, ""} {
+		sealed, err := k.Seal([]byte(plain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsSealed(sealed) || (plain != "" && strings.Contains(sealed, plain)) {
+			t.Fatalf("Seal(%q) = %q", plain, sealed)
+		}
+		got, err := k.Open(sealed)
+		if err != nil || string(got) != plain {
+			t.Fatalf("Open = %q, %v, want %q", got, err, plain)
+		}
+	}
+
+	a, _ := k.Seal([]byte("x"))
+	b, _ := k.Seal([]byte("x"))
+	if a == b {
+		t.Fatal("sealing the same value twice gave the same output")
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	k := keyring(t, newKey(t))
+	sealed, err := k.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(sealed, prefix), ":")
+	flip := func(part string) string {
+		b, _ := base64.RawURLEncoding.DecodeString(part)
+		b[len(b)-1] ^= 1
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	join := func(p ...string) string { return prefix + strings.Join(p, ":") }
+
+	other := keyring(t, newKey(t), newKey(t))
+	otherSealed, _ := other.Seal([]byte("x"))
+	otherID := strings.Split(strings.TrimPrefix(otherSealed, prefix), ":")[0]
+
+	for _, tc := range []struct {
+		name, value string
+		is          error
+	}{
+		{"wrapped key", join(parts[0], flip(parts[1]), parts[2]), nil},
+		{"ciphertext", join(parts[0], parts[1], flip(parts[2])), nil},
+		{"swapped bodies", join(parts[0], parts[1], strings.Split(otherSealed, ":")[4]), nil},
+		{"unknown key", join(otherID, parts[1], parts[2]), ErrUnknownKey},
+		{"truncated", join(parts[0], parts[1], "AAAA"), nil},
+		{"missing part", join(parts[0], parts[1]), nil},
+		{"bad base64", join(parts[0], "!!", parts[2]), nil},
+		{"plaintext", "secret", nil},
+	} {
+		got, err := k.Open(tc.value)
+		if err == nil {
+			t.Errorf("%s: Open = %q, want an error", tc.name, got)
+			continue
+		}
+		if tc.is != nil && !errors.Is(err, tc.is) {
+			t.Errorf("%s: error %v, want %v", tc.name, err, tc.is)
+		}
+	}
+
+	var none *Keyring
+	if _, err := none.Open(sealed); !errors.Is(err, ErrNoKey) {
+		t.Errorf("nil keyring: error %v, want ErrNoKey", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldKey, newKeyStr := newKey(t), newKey(t)
+	old := keyring(t, oldKey)
+	sealed, err := old.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Stale(sealed) || old.Stale("plaintext") {
+		t.Fatal("value reported stale under its own key")
+	}
+
+	rotated := keyring(t, newKeyStr, oldKey)
+	if got, err := rotated.Open(sealed); err != nil || string(got) != "secret" {
+		t.Fatalf("previous key can't open old value: %q, %v", got, err)
+	}
+	if !rotated.Stale(sealed) {
+		t.Fatal("value under the previous key not reported stale")
+	}
+	rewrapped, err := rotated.Rewrap(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Stale(rewrapped) {
+		t.Fatal("rewrapped value still stale")
+	}
+	// Only the data key is re-sealed; the value's ciphertext is kept.
+	body := func(s string) string { return s[strings.LastIndex(s, ":")+1:] }
+	if body(rewrapped) != body(sealed) {
+		t.Fatal("Rewrap re-encrypted the value")
+	}
+	if got, err := keyring(t, newKeyStr).Open(rewrapped); err != nil || string(got) != "secret" {
+		t.Fatalf("new key alone can't open rewrapped value: %q, %v", got, err)
+	}
+	if _, err := keyring(t, newKeyStr).Rewrap(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Rewrap without the old key: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	raw := make([]byte, KeySize)
+	for i := range raw {
+		raw[i] = byte(i * 7)
+	}
+	for _, s := range []string{
+		base64.StdEncoding.EncodeToString(raw),
+		" " + base64.StdEncoding.EncodeToString(raw) + "\n",
+		base64.RawURLEncoding.EncodeToString(raw),
+		base64.URLEncoding.EncodeToString(raw),
+	} {
+		got, err := ParseKey(s)
+		if err != nil || string(got) != string(raw) {
+			t.Errorf("ParseKey(%q) = %v, %v", s, got, err)
+		}
+	}
+	for _, tc := range []struct{ in, want string }{
+		{"not base64!", "not valid base64"},
+		{base64.StdEncoding.EncodeToString(raw[:16]), "16 bytes, want 32"},
+		{"", "0 bytes"},
+	} {
+		if _, err := ParseKey(tc.in); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseKey(%q) error %v, want %q", tc.in, err, tc.want)
+		}
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	current, previous := newKey(t), newKey(t)
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if k, err := LoadKeyring("", "", nil); k != nil || err != nil {
+		t.Fatalf("no key: %v, %v, want nil, nil", k, err)
+	}
+
+	file := write("keys", "# current first\n"+current+"\n\n  "+previous+"  \n")
+	fromFile, err := LoadKeyring("", file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedOld, _ := keyring(t, previous).Seal([]byte("x"))
+	if !fromFile.Stale(sealedOld) {
+		t.Fatal("second line of the key file isn't a previous key")
+	}
+	if _, err := fromFile.Open(sealedOld); err != nil {
+		t.Fatalf("previous key from file can't open: %v", err)
+	}
+	sealedNew, _ := fromFile.Seal([]byte("x"))
+	if keyring(t, current).Stale(sealedNew) {
+		t.Fatal("first line of the key file isn't the current key")
+	}
+
+	for _, tc := range []struct {
+		name, key, file string
+		previous        []string
+		want            string
+	}{
+		{"key and file", current, file, nil, "either a key or a key file"},
+		{"previous only", "", "", []string{previous}, "without a current key"},
+		{"empty file", "", write("empty", "# nothing here\n\n"), nil, "holds no key"},
+		{"missing file", "", filepath.Join(dir, "missing"), nil, "no such file"},
+		{"bad current", "short", "", nil, "master key"},
+		{"bad previous", current, "", []string{"short"}, "master key"},
+		{"bad line in file", "", write("bad", current+"\nshort\n"), nil, "master key"},
+	} {
+		if _, err := LoadKeyring(tc.key, tc.file, tc.previous); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"html/template"
+	"math"
 	"net/http"
+	"net/textproto"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
@@ -12,11 +18,12 @@ import (
 	"github.com/Secretstar513/crypto-alerts/internal/app"
 	"github.com/Secretstar513/crypto-alerts/internal/domain"
 	"github.com/Secretstar513/crypto-alerts/internal/notif"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram"
 )
 
 type Handlers struct {
-	App  *app.App
-	tpl  *template.Template
+	App *app.App
+	tpl *template.Template
 }
 
 func NewHandlers(a *app.App) *Handlers {
@@ -24,122 +31,451 @@ func NewHandlers(a *app.App) *Handlers {
 }
 
 func (h *Handlers) Index(w http.ResponseWriter, r *http.Request) {
-    list, _ := h.App.ListAlerts()
-    data := map[string]any{
-        "Alerts":      list,
-        "Page":        "alerts",
-        "ContentTmpl": "alerts_page",
-    }
-    if err := h.tpl.ExecuteTemplate(w, "base", data); err != nil {
-        http.Error(w, err.Error(), 500)
-        return
-    }
+	list, _ := h.App.ListAlerts()
+	chs, _ := h.App.ListChannels()
+	data := map[string]any{
+		"Alerts":      list,
+		"Sparks":      h.sparks(list),
+		"Channels":    chs,
+		"Exchanges":   domain.Exchanges,
+		"Page":        "alerts",
+		"ContentTmpl": "alerts_page",
+	}
+	if err := h.tpl.ExecuteTemplate(w, "base", data); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 }
 
 func (h *Handlers) CreateAlert(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, err.Error(), 400); return
+		http.Error(w, err.Error(), 400)
+		return
 	}
 	symbol := r.FormValue("symbol")
 	dir := r.FormValue("direction")
 	thr, _ := strconv.ParseFloat(r.FormValue("threshold"), 64)
-	al, err := h.App.CreateAlert(symbol, thr, domain.Direction(dir))
+	var chs []domain.Channel
+	for _, id := range r.Form["channels"] {
+		chs = append(chs, domain.Channel{ID: id})
+	}
+	al := domain.Alert{
+		Kind:       domain.AlertKind(r.FormValue("kind")),
+		Symbol:     symbol,
+		PairSymbol: strings.TrimSpace(r.FormValue("pairSymbol")),
+		Threshold:  thr,
+		Direction:  domain.Direction(dir),
+		Expr:       strings.TrimSpace(r.FormValue("expr")),
+		Severity:   domain.Severity(r.FormValue("severity")),
+		Channels:   chs,
+	}
+	// The exchange and indicator fields are always posted; only their kinds
+	// use them.
+	if al.Kind == domain.KindArbitrage {
+		al.Exchange, al.PairExchange = r.FormValue("exchange"), r.FormValue("pairExchange")
+	}
+	if al.Kind.Indicator() {
+		al.Interval = r.FormValue("interval")
+		al.Period, _ = strconv.Atoi(r.FormValue("period"))
+		al.SlowPeriod, _ = strconv.Atoi(r.FormValue("slowPeriod"))
+	}
+	al, err := h.App.CreateAlert(al)
 	if err != nil {
-		http.Error(w, err.Error(), 400); return
+		http.Error(w, err.Error(), 400)
+		return
 	}
 	log.Info().Str("id", al.ID).Msg("alert created")
 
 	list, _ := h.App.ListAlerts()
 	w.Header().Set("HX-Trigger", "alert-changed")
-	_ = h.tpl.ExecuteTemplate(w, "alerts", map[string]any{"Alerts": list})
+	_ = h.tpl.ExecuteTemplate(w, "alerts", map[string]any{"Alerts": list, "Sparks": h.sparks(list)})
 }
 
 func (h *Handlers) ToggleAlert(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	enable := r.FormValue("enable") == "true"
 	if err := h.App.ToggleAlert(id, enable); err != nil {
-		http.Error(w, err.Error(), 400); return
+		http.Error(w, err.Error(), 400)
+		return
 	}
 	list, _ := h.App.ListAlerts()
 	w.Header().Set("HX-Trigger", "alert-changed")
-	_ = h.tpl.ExecuteTemplate(w, "alerts", map[string]any{"Alerts": list})
+	_ = h.tpl.ExecuteTemplate(w, "alerts", map[string]any{"Alerts": list, "Sparks": h.sparks(list)})
 }
 
 func (h *Handlers) DeleteAlert(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if err := h.App.DeleteAlert(id); err != nil {
-		http.Error(w, err.Error(), 400); return
+		http.Error(w, err.Error(), 400)
+		return
 	}
 	list, _ := h.App.ListAlerts()
 	w.Header().Set("HX-Trigger", "alert-changed")
-	_ = h.tpl.ExecuteTemplate(w, "alerts", map[string]any{"Alerts": list})
+	_ = h.tpl.ExecuteTemplate(w, "alerts", map[string]any{"Alerts": list, "Sparks": h.sparks(list)})
+}
+
+// sparks renders a 24h sparkline per alert from 5m candles, keyed by alert ID.
+// Ratio and spread alerts plot their derived series over the bars both legs
+// have.
+func (h *Handlers) sparks(list []domain.Alert) map[string]template.HTML {
+	candles := map[string][]domain.Candle{}
+	since := time.Now().Add(-24 * time.Hour)
+	load := func(symbol string) []domain.Candle {
+		cs, ok := candles[symbol]
+		if !ok {
+			cs, _ = h.App.Candles(symbol, "5m", since, time.Time{}, 288)
+			candles[symbol] = cs
+		}
+		return cs
+	}
+	out := map[string]template.HTML{}
+	for _, al := range list {
+		// Candles only hold Binance prices, so there's no arbitrage, volume
+		// or change history.
+		if al.Kind == domain.KindArbitrage || al.Kind == domain.KindVolume || al.Kind == domain.KindChange {
+			continue
+		}
+		if al.Kind.Indicator() {
+			// Moving-average alerts plot the distance from their line, so
+			// the cross they watch is at 0.
+			line := 0.0
+			if al.HasThreshold() {
+				line = al.Threshold
+			}
+			vals, _ := h.App.IndicatorHistory(al, 288)
+			out[al.ID] = sparkline(vals, line)
+			continue
+		}
+		var closes []float64
+		if al.PairSymbol == "" {
+			for _, c := range load(al.Symbol) {
+				closes = append(closes, c.Close)
+			}
+		} else {
+			pair := map[time.Time]float64{}
+			for _, c := range load(al.PairSymbol) {
+				pair[c.OpenTime] = c.Close
+			}
+			for _, c := range load(al.Symbol) {
+				if p, ok := pair[c.OpenTime]; ok {
+					closes = append(closes, al.Derive(c.Close, p))
+				}
+			}
+		}
+		// Conditions have no single threshold to draw; breakout alerts draw
+		// the edge of the day's range they watch.
+		line := al.Threshold
+		if al.Expr != "" || !al.HasThreshold() {
+			line = math.NaN()
+		}
+		if d := al.Kind.Direction(); d != "" && len(closes) > 0 {
+			line = closes[0]
+			for _, c := range closes {
+				if d == domain.DirectionUp {
+					line = max(line, c)
+				} else {
+					line = min(line, c)
+				}
+			}
+		}
+		out[al.ID] = sparkline(closes, line)
+	}
+	return out
 }
 
 func (h *Handlers) ChannelsPage(w http.ResponseWriter, r *http.Request) {
-    chs, _ := h.App.ListChannels()
-
-    emailEnabled := true
-    emailCfg := notif.EmailConfig{}
-    tgEnabled := true
-    tgCfg := struct {
-        BotToken string `json:"botToken"`
-        ChatID   string `json:"chatID"`
-    }{}
-
-    for _, ch := range chs {
-        switch ch.Kind {
-        case domain.ChannelEmail:
-            emailEnabled = ch.Enabled
-            _ = json.Unmarshal([]byte(ch.Config), &emailCfg)
-        case domain.ChannelTelegram:
-            tgEnabled = ch.Enabled
-            _ = json.Unmarshal([]byte(ch.Config), &tgCfg)
-        }
-    }
-
-    data := map[string]any{
-        "Page":          "channels",
-        "EmailEnabled":  emailEnabled,
-        "Email":         emailCfg,
-        "TGEnabled":     tgEnabled,
-        "Telegram":      tgCfg,
-        "Saved":         r.URL.Query().Get("saved") == "1",
-    }
-
-    if err := h.tpl.ExecuteTemplate(w, "base", data); err != nil {
-        http.Error(w, err.Error(), 500)
-        return
-    }
+	chs, _ := h.App.ListChannels()
+
+	emailEnabled := true
+	emailCh := domain.Channel{MinSeverity: domain.SeverityInfo}
+	emailCfg := notif.EmailConfig{}
+	tgEnabled := true
+	tgCh := domain.Channel{MinSeverity: domain.SeverityInfo}
+	tgCfg := notif.TelegramConfig{}
+
+	for _, ch := range chs {
+		switch ch.Kind {
+		case domain.ChannelEmail:
+			emailEnabled = ch.Enabled
+			emailCh = ch
+		case domain.ChannelTelegram:
+			tgEnabled = ch.Enabled
+			tgCh = ch
+		}
+	}
+	if _, err := h.App.ChannelConfig(domain.ChannelEmail, &emailCfg); err != nil {
+		log.Error().Err(err).Msg("read email channel config")
+	}
+	if _, err := h.App.ChannelConfig(domain.ChannelTelegram, &tgCfg); err != nil {
+		log.Error().Err(err).Msg("read telegram channel config")
+	}
+
+	// Secrets are write-only: the page only says whether one is saved.
+	passSet, tokenSet := emailCfg.Pass != "", tgCfg.BotToken != ""
+	emailCfg.Pass, tgCfg.BotToken = "", ""
+
+	data := map[string]any{
+		"Page":         "channels",
+		"EmailEnabled": emailEnabled,
+		"Email":        emailCfg,
+		"EmailChannel": emailCh,
+		"EmailPassSet": passSet,
+		"TGEnabled":    tgEnabled,
+		"TGChannel":    tgCh,
+		"Telegram":     tgCfg,
+		"TGTokenSet":   tokenSet,
+		"Saved":        r.URL.Query().Get("saved") == "1",
+	}
+
+	if err := h.tpl.ExecuteTemplate(w, "base", data); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 }
 
 func (h *Handlers) UpsertEmail(w http.ResponseWriter, r *http.Request) {
-    _ = r.ParseForm()
-    cfg := notif.EmailConfig{
-        Host: r.FormValue("host"),
-        Port: r.FormValue("port"),
-        User: r.FormValue("user"),
-        Pass: r.FormValue("pass"),
-        From: r.FormValue("from"),
-        To:   r.FormValue("to"),
-    }
-    enabled := r.FormValue("enabled") == "on"
-    if err := h.App.UpsertChannel(domain.ChannelEmail, enabled, cfg); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest); return
-    }
-    w.Header().Set("HX-Trigger", "channels-saved")
-    w.WriteHeader(http.StatusNoContent)
+	_ = r.ParseForm()
+	cfg := notif.EmailConfig{
+		Host: r.FormValue("host"),
+		Port: r.FormValue("port"),
+		User: r.FormValue("user"),
+		Pass: r.FormValue("pass"),
+		From: r.FormValue("from"),
+		To:   r.FormValue("to"),
+	}
+	if cfg.Pass == "" && r.FormValue("clearPass") != "on" {
+		var cur notif.EmailConfig
+		if _, err := h.App.ChannelConfig(domain.ChannelEmail, &cur); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cfg.Pass = cur.Pass
+	}
+	ch := channelFromForm(r, domain.ChannelEmail)
+	if err := h.App.UpsertChannel(ch, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("HX-Trigger", "channels-saved")
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *Handlers) UpsertTelegram(w http.ResponseWriter, r *http.Request) {
-    _ = r.ParseForm()
-    cfg := map[string]string{
-        "botToken": r.FormValue("botToken"),
-        "chatID":   r.FormValue("chatID"),
-    }
-    enabled := r.FormValue("enabled") == "on"
-    if err := h.App.UpsertChannel(domain.ChannelTelegram, enabled, cfg); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest); return
-    }
-    w.Header().Set("HX-Trigger", "channels-saved")
-    w.WriteHeader(http.StatusNoContent)
+	_ = r.ParseForm()
+	cfg := notif.TelegramConfig{
+		BotToken:  r.FormValue("botToken"),
+		ChatID:    r.FormValue("chatID"),
+		ParseMode: r.FormValue("parseMode"),
+	}
+	if cfg.BotToken == "" && r.FormValue("clearBotToken") != "on" {
+		var cur notif.TelegramConfig
+		if _, err := h.App.ChannelConfig(domain.ChannelTelegram, &cur); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cfg.BotToken = cur.BotToken
+	}
+	ch := channelFromForm(r, domain.ChannelTelegram)
+	if err := h.App.UpsertChannel(ch, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("HX-Trigger", "channels-saved")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// channelFromForm reads the settings shared by every channel form.
+func channelFromForm(r *http.Request, kind domain.ChannelKind) domain.Channel {
+	return domain.Channel{
+		Kind:        kind,
+		Enabled:     r.FormValue("enabled") == "on",
+		MinSeverity: domain.Severity(r.FormValue("minSeverity")),
+		Schedule: domain.Schedule{
+			Timezone:         strings.TrimSpace(r.FormValue("timezone")),
+			From:             r.FormValue("activeFrom"),
+			To:               r.FormValue("activeTo"),
+			Days:             strings.Join(r.Form["days"], ","),
+			QuietPolicy:      domain.QuietPolicy(r.FormValue("quietPolicy")),
+			CriticalOverride: r.FormValue("criticalOverride") == "on",
+		},
+		Digest:       domain.DigestMode(r.FormValue("digest")),
+		DigestAt:     r.FormValue("digestAt"),
+		DailySummary: r.FormValue("dailySummary") == "on",
+	}
+}
+
+func (h *Handlers) TestChannel(w http.ResponseWriter, r *http.Request) {
+	kind := domain.ChannelKind(strings.ToUpper(chi.URLParam(r, "kind")))
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	err := h.App.TestChannel(ctx, kind)
+	if errors.Is(err, app.ErrUnknownChannel) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("channel", string(kind)).Msg("test notification failed")
+		msg := testFailure(err)
+		setTrigger(w, "channel-test-failed", msg)
+		http.Error(w, msg, http.StatusBadGateway)
+		return
+	}
+	setTrigger(w, "channel-test-sent", "Test notification sent via "+strings.ToLower(string(kind)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testFailure is what the browser is told about a failed test notification:
+// the channel's own reply, or that the channel is off or incomplete. Other
+// errors, such as a failed connection, can quote endpoints and settings, so
+// they only go to the server log.
+func testFailure(err error) string {
+	var apiErr *telegram.APIError
+	var smtpErr *textproto.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Error()
+	case errors.As(err, &smtpErr):
+		return "SMTP " + smtpErr.Error()
+	case errors.Is(err, app.ErrChannelDisabled), errors.Is(err, notif.ErrNotConfigured):
+		return err.Error()
+	}
+	return "couldn't deliver it; see the server log for details"
+}
+
+// setTrigger sets an HX-Trigger header carrying msg as the event detail.
+func setTrigger(w http.ResponseWriter, event, msg string) {
+	js, _ := json.Marshal(map[string]string{event: msg})
+	w.Header().Set("HX-Trigger", string(js))
+}
+
+type candleJSON struct {
+	Time    int64   `json:"t"`
+	Open    float64 `json:"o"`
+	High    float64 `json:"h"`
+	Low     float64 `json:"l"`
+	Close   float64 `json:"c"`
+	Updates int     `json:"n"`
+}
+
+// Candles serves GET /api/candles?symbol=BTCUSDT&interval=1m&limit=500&from=&to=
+// with from/to as RFC3339 or unix seconds.
+func (h *Handlers) Candles(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	symbol := strings.ToUpper(q.Get("symbol"))
+	if symbol == "" {
+		http.Error(w, "symbol required", http.StatusBadRequest)
+		return
+	}
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "1m"
+	}
+	from, err := parseTime(q.Get("from"))
+	if err != nil {
+		http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(q.Get("to"))
+	if err != nil {
+		http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	cs, err := h.App.Candles(symbol, interval, from, to, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out := make([]candleJSON, len(cs))
+	for i, c := range cs {
+		out[i] = candleJSON{Time: c.OpenTime.Unix(), Open: c.Open, High: c.High, Low: c.Low, Close: c.Close, Updates: c.Count}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// StatusPage shows the health of every price feed. The table re-polls itself,
+// so it's served whole and swapped in by id.
+func (h *Handlers) StatusPage(w http.ResponseWriter, r *http.Request) {
+	feeds, err := h.App.FeedStatus()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	data := map[string]any{
+		"Feeds":      feeds,
+		"StaleAfter": h.App.Cfg.StaleAfter,
+		"Page":       "status",
+	}
+	if err := h.tpl.ExecuteTemplate(w, "base", data); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+type feedJSON struct {
+	Exchange   string     `json:"exchange"`
+	Symbol     string     `json:"symbol"`
+	State      string     `json:"state"`
+	Transport  string     `json:"transport,omitempty"`
+	Since      time.Time  `json:"since"`
+	LastUpdate *time.Time `json:"lastUpdate"`
+	LastPrice  float64    `json:"lastPrice,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+	Alerts     int        `json:"alerts"`
+	Stale      bool       `json:"stale"`
+}
+
+// Status serves GET /api/status.
+func (h *Handlers) Status(w http.ResponseWriter, r *http.Request) {
+	feeds, err := h.App.FeedStatus()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	out := make([]feedJSON, len(feeds))
+	for i, f := range feeds {
+		out[i] = feedJSON{
+			Exchange: f.Exchange, Symbol: f.Symbol, State: string(f.State), Transport: f.Transport, Since: f.Since,
+			LastPrice: f.LastPrice, LastError: f.LastError, Alerts: f.Alerts, Stale: f.Stale,
+		}
+		if !f.LastUpdate.IsZero() {
+			out[i].LastUpdate = &f.LastUpdate
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"staleAfter": h.App.Cfg.StaleAfter.String(),
+		"feeds":      out,
+	})
+}
+
+// Healthz is the liveness probe: the process is up and serving HTTP.
+func (h *Handlers) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// Readyz is the readiness probe; see app.App.Ready.
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := h.App.Ready(ctx); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("not ready: " + err.Error() + "\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
 }
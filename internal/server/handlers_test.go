@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nuid"
+
+	"github.com/Secretstar513/crypto-alerts/internal/app"
+	"github.com/Secretstar513/crypto-alerts/internal/config"
+	"github.com/Secretstar513/crypto-alerts/internal/telegram/telegramtest"
+)
+
+const testToken = "123456:SECRET-TOKEN"
+
+// newTestApp starts an App on a private in-memory database whose Telegram
+// channel, configured from the environment, talks to apiURL.
+func newTestApp(t *testing.T, apiURL string) *app.App {
+	t.Helper()
+	cfg := config.Default()
+	cfg.DBPath = fmt.Sprintf("file:%s?mode=memory&cache=shared", nuid.Next())
+	cfg.BinanceWSURL = "ws://127.0.0.1:1"
+	cfg.BinanceRESTURL = "http://127.0.0.1:1"
+	cfg.CoinbaseWSURL = "ws://127.0.0.1:1"
+	cfg.CoinbaseRESTURL = "http://127.0.0.1:1"
+	cfg.TelegramAPIURL = apiURL
+	cfg.TelegramBotToken = testToken
+	cfg.TelegramChatID = "42"
+	a := app.New(cfg)
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		_ = a.Stop()
+	})
+	return a
+}
+
+func TestTestChannel(t *testing.T) {
+	tg := telegramtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	for _, tc := range []struct {
+		name     string
+		apiURL   string
+		path     string
+		fail     int
+		code     int
+		event    string
+		wantText string
+	}{
+		{"sent", tg.URL, "/channels/telegram/test", 0, http.StatusNoContent, "channel-test-sent", "Test notification sent via telegram"},
+		{"rejected", tg.URL, "/channels/telegram/test", http.StatusUnauthorized, http.StatusBadGateway, "channel-test-failed", "telegram sendMessage: 401 Unauthorized"},
+		{"unreachable", "http://127.0.0.1:1", "/channels/telegram/test", 0, http.StatusBadGateway, "channel-test-failed", "see the server log"},
+		{"unknown kind", tg.URL, "/channels/sms/test", 0, http.StatusNotFound, "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handlers{App: newTestApp(t, tc.apiURL)}
+			if tc.fail != 0 {
+				tg.FailNext(tc.fail, "Unauthorized", 0)
+			}
+			sent := len(tg.Sent())
+
+			w := httptest.NewRecorder()
+			Routes(h).ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, nil))
+			if w.Code != tc.code {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tc.code, w.Body)
+			}
+			trigger := w.Header().Get("HX-Trigger")
+			if strings.Contains(trigger, testToken) || strings.Contains(w.Body.String(), testToken) {
+				t.Fatalf("response leaks the bot token: %s %s", trigger, w.Body)
+			}
+			if tc.event == "" {
+				return
+			}
+			var events map[string]string
+			if err := json.Unmarshal([]byte(trigger), &events); err != nil {
+				t.Fatalf("HX-Trigger %q: %v", trigger, err)
+			}
+			if msg, ok := events[tc.event]; !ok || !strings.Contains(msg, tc.wantText) {
+				t.Fatalf("HX-Trigger = %v, want %s containing %q", events, tc.event, tc.wantText)
+			}
+
+			want := sent
+			if tc.code == http.StatusNoContent {
+				want++
+			}
+			if got := tg.Sent(); len(got) != want {
+				t.Fatalf("fake API received %d messages, want %d", len(got), want)
+			} else if tc.code == http.StatusNoContent {
+				if text, _ := got[len(got)-1].Body["text"].(string); !strings.HasPrefix(text, "TEST ") {
+					t.Fatalf("test message = %q", text)
+				}
+			}
+		})
+	}
+}
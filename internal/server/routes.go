@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func Routes(h *Handlers) http.Handler {
@@ -16,6 +17,15 @@ func Routes(h *Handlers) http.Handler {
 	r.Get("/channels", h.ChannelsPage)
 	r.Post("/channels/email", h.UpsertEmail)
 	r.Post("/channels/telegram", h.UpsertTelegram)
+	r.Post("/channels/{kind}/test", h.TestChannel)
+
+	r.Get("/status", h.StatusPage)
+
+	r.Get("/api/candles", h.Candles)
+	r.Get("/api/status", h.Status)
+	r.Handle("/metrics", promhttp.Handler())
+	r.Get("/healthz", h.Healthz)
+	r.Get("/readyz", h.Readyz)
 
 	fs := http.FileServer(http.Dir("web/static"))
 	r.Handle("/static/*", http.StripPrefix("/static/", fs))
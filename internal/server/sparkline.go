@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+)
+
+const (
+	sparkW   = 120
+	sparkH   = 28
+	sparkPad = 2
+)
+
+// sparkline renders closes as an inline SVG polyline with the alert threshold
+// as a dashed horizontal line, or none when threshold is NaN. A threshold far
+// outside the price range is pinned to the top or bottom edge so the price
+// line stays readable.
+func sparkline(closes []float64, threshold float64) template.HTML {
+	if len(closes) < 2 {
+		return ""
+	}
+	lo, hi := closes[0], closes[0]
+	for _, c := range closes {
+		lo = math.Min(lo, c)
+		hi = math.Max(hi, c)
+	}
+	// Let the threshold widen the range by up to half of it; beyond that it is
+	// drawn at the edge.
+	span := hi - lo
+	if span == 0 {
+		span = math.Max(math.Abs(hi)*0.001, 1e-9)
+	}
+	if threshold < lo && lo-threshold <= span/2 {
+		lo = threshold
+	}
+	if threshold > hi && threshold-hi <= span/2 {
+		hi = threshold
+	}
+	if hi == lo {
+		hi, lo = hi+span/2, lo-span/2
+	}
+
+	y := func(v float64) float64 {
+		v = math.Max(lo, math.Min(hi, v))
+		return sparkPad + (hi-v)/(hi-lo)*(sparkH-2*sparkPad)
+	}
+	step := float64(sparkW-2*sparkPad) / float64(len(closes)-1)
+
+	var pts strings.Builder
+	for i, c := range closes {
+		fmt.Fprintf(&pts, "%.1f,%.1f ", sparkPad+float64(i)*step, y(c))
+	}
+	var line string
+	if !math.IsNaN(threshold) {
+		ty := y(threshold)
+		line = fmt.Sprintf(`<line x1="0" x2="%d" y1="%.1f" y2="%.1f" stroke="#f59e0b" stroke-width="1" stroke-dasharray="3 2"/>`, sparkW, ty, ty)
+	}
+	return template.HTML(fmt.Sprintf(
+		`<svg class="spark" width="%d" height="%d" viewBox="0 0 %d %d" aria-hidden="true">`+
+			`%s`+
+			`<polyline fill="none" stroke="#7dd3fc" stroke-width="1.5" stroke-linejoin="round" points="%s"/>`+
+			`</svg>`,
+		sparkW, sparkH, sparkW, sparkH, line, strings.TrimSpace(pts.String())))
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"math"
+	"regexp"
+	"testing"
+)
+
+var (
+	sparkPoints = regexp.MustCompile(`points="([^"]*)"`)
+	sparkLine   = regexp.MustCompile(`<line [^>]*y1="([^"]*)"`)
+)
+
+func TestSparkline(t *testing.T) {
+	// The plot spans y 2 (top) to 26 (bottom) and x 2 to 118.
+	for _, tc := range []struct {
+		name      string
+		closes    []float64
+		threshold float64
+		points    string
+		line      string // y of the threshold line, "" for none
+	}{
+		{"rising", []float64{10, 20}, 15, "2.0,26.0 118.0,2.0", "14.0"},
+		{"flat", []float64{5, 5, 5}, math.NaN(), "2.0,14.0 60.0,14.0 118.0,14.0", ""},
+		{"flat at threshold", []float64{5, 5}, 5, "2.0,14.0 118.0,14.0", "14.0"},
+		{"threshold just below", []float64{10, 20}, 8, "2.0,22.0 118.0,2.0", "26.0"},
+		{"threshold far above", []float64{10, 20}, 100, "2.0,26.0 118.0,2.0", "2.0"},
+		{"threshold far below", []float64{10, 20}, -100, "2.0,26.0 118.0,2.0", "26.0"},
+		{"condition alert", []float64{10, 15, 20}, math.NaN(), "2.0,26.0 60.0,14.0 118.0,2.0", ""},
+	} {
+		svg := string(sparkline(tc.closes, tc.threshold))
+		if m := sparkPoints.FindStringSubmatch(svg); m == nil || m[1] != tc.points {
+			t.Errorf("%s: points = %v, want %q in\n%s", tc.name, m, tc.points, svg)
+		}
+		var line string
+		if m := sparkLine.FindStringSubmatch(svg); m != nil {
+			line = m[1]
+		}
+		if line != tc.line {
+			t.Errorf("%s: threshold line at %q, want %q", tc.name, line, tc.line)
+		}
+	}
+
+	for _, closes := range [][]float64{nil, {42}} {
+		if svg := sparkline(closes, 42); svg != "" {
+			t.Errorf("sparkline(%v) = %q, want nothing", closes, svg)
+		}
+	}
+}
@@ -3,12 +3,24 @@ package server
 import (
 	"html/template"
 	"path/filepath"
+	"time"
 )
 
+var funcs = template.FuncMap{
+	"list": func(v ...string) []string { return v },
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+}
+
 func loadTemplates() *template.Template {
 	base := filepath.Join("web", "templates", "base.tmpl.html")
 	index := filepath.Join("web", "templates", "index.tmpl.html")
 	alerts := filepath.Join("web", "templates", "alerts.tmpl.html")
 	channels := filepath.Join("web", "templates", "channels.tmpl.html")
-	return template.Must(template.ParseFiles(base, index, alerts, channels))
+	status := filepath.Join("web", "templates", "status.tmpl.html")
+	return template.Must(template.New("").Funcs(funcs).ParseFiles(base, index, alerts, channels, status))
 }
@@ -0,0 +1,205 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the public Bot API endpoint.
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Parse modes accepted by sendMessage. An empty mode sends plain text.
+const (
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeHTML       = "HTML"
+)
+
+// Client is a minimal Telegram Bot API client. BaseURL can point at a local
+// stub (see telegramtest) instead of the public API.
+type Client struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 70 * time.Second},
+	}
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+type Message struct {
+	MessageID       int64  `json:"message_id"`
+	MessageThreadID int64  `json:"message_thread_id,omitempty"`
+	Chat            Chat   `json:"chat"`
+	Text            string `json:"text"`
+}
+
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message,omitempty"`
+}
+
+// OutgoingMessage is the sendMessage request body.
+type OutgoingMessage struct {
+	ChatID          string `json:"chat_id"`
+	MessageThreadID int64  `json:"message_thread_id,omitempty"`
+	Text            string `json:"text"`
+	ParseMode       string `json:"parse_mode,omitempty"`
+}
+
+// Target is a chat, or a forum topic within one when ThreadID is set.
+type Target struct {
+	ChatID   string
+	ThreadID int64
+}
+
+// ParseTargets parses a comma-separated list of chat IDs, where a
+// "chat:thread" entry targets a forum topic. Blank entries are skipped.
+func ParseTargets(s string) ([]Target, error) {
+	var out []Target
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		chat, thread, ok := strings.Cut(part, ":")
+		t := Target{ChatID: chat}
+		if ok {
+			id, err := strconv.ParseInt(thread, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("chat %q: thread %q is not a positive integer", chat, thread)
+			}
+			t.ThreadID = id
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// Matches reports whether m was posted in t: in its chat and, if t names a
+// thread, in that topic.
+func (t Target) Matches(m *Message) bool {
+	return t.ChatID == strconv.FormatInt(m.Chat.ID, 10) && (t.ThreadID == 0 || t.ThreadID == m.MessageThreadID)
+}
+
+// APIError is a non-ok Bot API response. RetryAfter is set when Telegram
+// rate-limits the bot (HTTP 429).
+type APIError struct {
+	Method      string
+	Code        int
+	Description string
+	RetryAfter  time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("telegram %s: %d %s (retry after %s)", e.Method, e.Code, e.Description, e.RetryAfter)
+	}
+	return fmt.Sprintf("telegram %s: %d %s", e.Method, e.Code, e.Description)
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// GetUpdates long-polls for updates newer than offset, waiting up to timeout.
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	req := map[string]any{
+		"offset":          offset,
+		"timeout":         int(timeout / time.Second),
+		"allowed_updates": []string{"message"},
+	}
+	var out []Update
+	return out, c.call(ctx, "getUpdates", req, &out)
+}
+
+// SendMessage sends a plain-text message to chatID.
+func (c *Client) SendMessage(ctx context.Context, chatID, text string) error {
+	return c.Send(ctx, OutgoingMessage{ChatID: chatID, Text: text})
+}
+
+// Send delivers m, returning an *APIError if Telegram rejects it.
+func (c *Client) Send(ctx context.Context, m OutgoingMessage) error {
+	return c.call(ctx, "sendMessage", m, nil)
+}
+
+func (c *Client) call(ctx context.Context, method string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/%s", c.BaseURL, c.Token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return stripURL(method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return stripURL(method, err)
+	}
+	defer resp.Body.Close()
+
+	var res apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("telegram %s: %s: %w", method, resp.Status, err)
+	}
+	if !res.OK {
+		return &APIError{
+			Method:      method,
+			Code:        res.ErrorCode,
+			Description: res.Description,
+			RetryAfter:  time.Duration(res.Parameters.RetryAfter) * time.Second,
+		}
+	}
+	if out != nil {
+		return json.Unmarshal(res.Result, out)
+	}
+	return nil
+}
+
+// stripURL drops the request URL, which contains the bot token, from an
+// error about a call to method, since such errors end up in logs and toasts.
+func stripURL(method string, err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+	return fmt.Errorf("telegram %s: %w", method, err)
+}
+
+var markdownV2Special = strings.NewReplacer(
+	"_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-",
+	"=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+	"\\", "\\\\",
+)
+
+// EscapeMarkdownV2 escapes s for use as literal text in a MarkdownV2 message.
+func EscapeMarkdownV2(s string) string {
+	return markdownV2Special.Replace(s)
+}
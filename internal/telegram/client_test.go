@@ -0,0 +1,142 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Secretstar513/crypto-alerts/internal/telegram/telegramtest"
+)
+
+func TestErrorsHideToken(t *testing.T) {
+	const token = "123456:SECRET-TOKEN"
+	c := NewClient("http://127.0.0.1:1", token)
+
+	err := c.SendMessage(context.Background(), "42", "hi")
+	if err == nil || strings.Contains(err.Error(), token) || !strings.HasPrefix(err.Error(), "telegram sendMessage: ") {
+		t.Fatalf("unreachable API: err = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.GetUpdates(ctx, 0, 0)
+	if !errors.Is(err, context.Canceled) || strings.Contains(err.Error(), token) {
+		t.Fatalf("canceled call: err = %v", err)
+	}
+
+	c.BaseURL = "http://bad host"
+	if err := c.SendMessage(context.Background(), "42", "hi"); err == nil || strings.Contains(err.Error(), token) {
+		t.Fatalf("bad URL: err = %v", err)
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    []Target
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"42", []Target{{ChatID: "42"}}, false},
+		{" 42 , -1001,, @alerts ", []Target{{ChatID: "42"}, {ChatID: "-1001"}, {ChatID: "@alerts"}}, false},
+		{"-1001:7,42", []Target{{ChatID: "-1001", ThreadID: 7}, {ChatID: "42"}}, false},
+		{"-1001:general", nil, true},
+		{"-1001:0", nil, true},
+		{"-1001:", nil, true},
+	} {
+		got, err := ParseTargets(tc.in)
+		if (err != nil) != tc.wantErr || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseTargets(%q) = %v, %v; want %v, error %v", tc.in, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestTargetMatches(t *testing.T) {
+	msg := func(chat, thread int64) *Message {
+		return &Message{Chat: Chat{ID: chat}, MessageThreadID: thread}
+	}
+	for _, tc := range []struct {
+		target Target
+		m      *Message
+		want   bool
+	}{
+		{Target{ChatID: "42"}, msg(42, 0), true},
+		{Target{ChatID: "42"}, msg(42, 9), true},
+		{Target{ChatID: "42"}, msg(43, 0), false},
+		{Target{ChatID: "-1001", ThreadID: 7}, msg(-1001, 7), true},
+		{Target{ChatID: "-1001", ThreadID: 7}, msg(-1001, 0), false},
+		{Target{ChatID: "-1001", ThreadID: 7}, msg(-1001, 8), false},
+	} {
+		if got := tc.target.Matches(tc.m); got != tc.want {
+			t.Errorf("%+v.Matches(chat %d thread %d) = %v", tc.target, tc.m.Chat.ID, tc.m.MessageThreadID, got)
+		}
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	for in, want := range map[string]string{
+		"BTCUSDT":                 "BTCUSDT",
+		"65000.5":                 "65000\\.5",
+		"BTC_USDT > 1 (or -2)!":   "BTC\\_USDT \\> 1 \\(or \\-2\\)\\!",
+		"*_[]()~`>#+-=|{}.!\\":    "\\*\\_\\[\\]\\(\\)\\~\\`\\>\\#\\+\\-\\=\\|\\{\\}\\.\\!\\\\",
+		"already \\. escaped? no": "already \\\\\\. escaped? no",
+	} {
+		if got := EscapeMarkdownV2(in); got != want {
+			t.Errorf("EscapeMarkdownV2(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	tg := telegramtest.NewServer()
+	t.Cleanup(tg.Close)
+	c := NewClient(tg.URL+"/", "123:TOKEN")
+
+	m := OutgoingMessage{ChatID: "-1001", MessageThreadID: 7, Text: "*hi*", ParseMode: ParseModeMarkdownV2}
+	if err := c.Send(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	sent := tg.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages", len(sent))
+	}
+	want := map[string]any{"chat_id": "-1001", "message_thread_id": float64(7), "text": "*hi*", "parse_mode": "MarkdownV2"}
+	if s := sent[0]; s.Token != "123:TOKEN" || !reflect.DeepEqual(s.Body, want) {
+		t.Fatalf("sent %+v, want body %v with the client's token", s, want)
+	}
+}
+
+func TestSendReturnsAPIErrors(t *testing.T) {
+	tg := telegramtest.NewServer()
+	t.Cleanup(tg.Close)
+	c := NewClient(tg.URL, "123:TOKEN")
+
+	for _, tc := range []struct {
+		code       int
+		desc       string
+		retryAfter int
+		wantText   string
+	}{
+		{429, "Too Many Requests: retry after 30", 30, "telegram sendMessage: 429 Too Many Requests: retry after 30 (retry after 30s)"},
+		{400, "Bad Request: chat not found", 0, "telegram sendMessage: 400 Bad Request: chat not found"},
+	} {
+		tg.FailNext(tc.code, tc.desc, tc.retryAfter)
+		err := c.SendMessage(context.Background(), "42", "hi")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("%d: err = %v, want an *APIError", tc.code, err)
+		}
+		if apiErr.Code != tc.code || apiErr.Method != "sendMessage" || apiErr.RetryAfter != time.Duration(tc.retryAfter)*time.Second {
+			t.Errorf("%d: got %+v", tc.code, apiErr)
+		}
+		if err.Error() != tc.wantText {
+			t.Errorf("%d: Error() = %q, want %q", tc.code, err.Error(), tc.wantText)
+		}
+	}
+	if n := len(tg.Sent()); n != 0 {
+		t.Fatalf("failed sends were recorded: %d", n)
+	}
+}
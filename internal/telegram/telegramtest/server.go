@@ -0,0 +1,155 @@
+// Package telegramtest provides an in-process fake of the Telegram Bot API
+// for exercising the bot and notifier without network access.
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sent is a message the fake API received through sendMessage.
+type Sent struct {
+	Token  string
+	Method string
+	Body   map[string]any
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	nextID  int64
+	updates []map[string]any
+	sent    []Sent
+	fail    []failure
+	wake    chan struct{}
+}
+
+type failure struct {
+	code       int
+	desc       string
+	retryAfter int
+}
+
+// NewServer starts a fake Bot API. Point telegram.NewClient at s.URL.
+func NewServer() *Server {
+	s := &Server{nextID: 1, wake: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// PushMessage queues an incoming text message from chatID, delivered on the
+// next getUpdates call.
+func (s *Server) PushMessage(chatID int64, text string) {
+	s.PushTopicMessage(chatID, 0, text)
+}
+
+// PushTopicMessage is PushMessage for a message posted in forum topic
+// threadID of chatID. A zero threadID is the chat's general thread.
+func (s *Server) PushTopicMessage(chatID, threadID int64, text string) {
+	msg := map[string]any{
+		"chat": map[string]any{"id": chatID},
+		"text": text,
+	}
+	if threadID != 0 {
+		msg["message_thread_id"] = threadID
+	}
+	s.mu.Lock()
+	msg["message_id"] = s.nextID
+	s.updates = append(s.updates, map[string]any{"update_id": s.nextID, "message": msg})
+	s.nextID++
+	close(s.wake)
+	s.wake = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// FailNext makes the next sendMessage call fail with the given Bot API error
+// code. A non-zero retryAfter is reported in seconds, as Telegram does for 429.
+func (s *Server) FailNext(code int, desc string, retryAfter int) {
+	s.mu.Lock()
+	s.fail = append(s.fail, failure{code: code, desc: desc, retryAfter: retryAfter})
+	s.mu.Unlock()
+}
+
+// Sent returns a copy of every sendMessage request received so far.
+func (s *Server) Sent() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent(nil), s.sent...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// Paths look like /bot<token>/<method>.
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+	token, method := strings.TrimPrefix(parts[0], "bot"), parts[1]
+
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch method {
+	case "getUpdates":
+		reply(w, s.getUpdates(r, body))
+	case "sendMessage":
+		s.mu.Lock()
+		if len(s.fail) > 0 {
+			f := s.fail[0]
+			s.fail = s.fail[1:]
+			s.mu.Unlock()
+			w.WriteHeader(f.code)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"ok": false, "error_code": f.code, "description": f.desc,
+				"parameters": map[string]any{"retry_after": f.retryAfter},
+			})
+			return
+		}
+		s.sent = append(s.sent, Sent{Token: token, Method: method, Body: body})
+		s.mu.Unlock()
+		reply(w, map[string]any{"message_id": time.Now().UnixNano()})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok": false, "error_code": 404, "description": "Not Found: method not found",
+		})
+	}
+}
+
+func (s *Server) getUpdates(r *http.Request, body map[string]any) []map[string]any {
+	offset, _ := body["offset"].(float64)
+	timeout, _ := body["timeout"].(float64)
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		s.mu.Lock()
+		var out []map[string]any
+		for _, u := range s.updates {
+			if id, _ := u["update_id"].(int64); float64(id) >= offset {
+				out = append(out, u)
+			}
+		}
+		wake := s.wake
+		s.mu.Unlock()
+		if len(out) > 0 || timeout <= 0 {
+			return out
+		}
+		select {
+		case <-wake:
+		case <-deadline:
+			return nil
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+func reply(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}